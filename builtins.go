@@ -0,0 +1,55 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+// newBuiltins returns the commands that are built into every Shell
+func newBuiltins() CommandMap {
+	return CommandMap{
+		"disable": describedFunc{disableCommand, Description{
+			Summary: "Lower the privilege level",
+			Usage:   "[level]",
+			Help:    "Returns to the default privilege level unless a level is given.",
+		}},
+		"enable": describedFunc{enableCommand, Description{
+			Summary:  "Raise the privilege level",
+			Usage:    "[level]",
+			Help:     "Prompts for a password and raises the privilege level, to the highest level unless a level is given.",
+			Examples: []string{"enable", "enable 5"},
+		}},
+		"fg": describedFunc{fgCommand, Description{
+			Summary: "Display the output of a background job and wait for it",
+			Usage:   "<job>",
+		}},
+		"help": describedFunc{helpCommand, Description{
+			Summary:  "Display help for commands",
+			Usage:    "[command]",
+			Help:     "Lists the available commands or, when given a command, describes it.",
+			Examples: []string{"help", "help show interface"},
+		}},
+		"jobs": describedFunc{jobsCommand, Description{
+			Summary: "List background jobs",
+		}},
+		"kill": describedFunc{killCommand, Description{
+			Summary: "Stop a background job",
+			Usage:   "<job>",
+		}},
+		"source": describedFunc{sourceCommand, Description{
+			Summary: "Run each line of a file as a command",
+			Usage:   "<file>",
+		}},
+	}
+}
@@ -0,0 +1,100 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"fmt"
+)
+
+// chainLink is a pipeline along with the operator that connects it to the
+// previous pipeline of the chain.  The operator of the first link is empty
+type chainLink struct {
+	operator string
+	pipeline *pipeline
+}
+
+// chain is a list of pipelines joined by ;, && or ||
+type chain []chainLink
+
+// isChainOperator reports whether operator separates the pipelines of a chain
+func isChainOperator(operator string) bool {
+	return operator == sequenceOperator || operator == andOperator || operator == orOperator
+}
+
+// parseChain splits the tokens into pipelines at each chain operator.  A
+// trailing ; is allowed, but every other operator must be both preceded and
+// followed by a command
+func parseChain(tokens []token) (chain, error) {
+	var c chain
+	operator := ""
+	begin := 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && (tokens[i].kind != operatorToken || !isChainOperator(tokens[i].value)) {
+			continue
+		}
+
+		if i == begin {
+			if i == len(tokens) && operator == sequenceOperator {
+				break
+			}
+			return nil, ErrEmptyCommand
+		}
+
+		p, err := parsePipeline(tokens[begin:i])
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, chainLink{operator: operator, pipeline: p})
+
+		if i < len(tokens) {
+			operator = tokens[i].value
+		}
+		begin = i + 1
+	}
+	return c, nil
+}
+
+// execChain executes each pipeline of the chain with exec.  A pipeline
+// following && is skipped when the last pipeline to execute failed and a
+// pipeline following || is skipped when it succeeded.  When a failed pipeline
+// is followed by another that executes, the failure is written to inv.Stderr.
+// The error of the last pipeline to execute is returned.  Once ctx is
+// cancelled, such as by an interrupt, the rest of the chain is abandoned and
+// the context's error is returned
+func (shell *Shell) execChain(ctx context.Context, inv *Invocation, c chain, exec func(context.Context, *Invocation, *pipeline) error) error {
+	var err error
+	for i, link := range c {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if i > 0 {
+			if (link.operator == andOperator && err != nil) || (link.operator == orOperator && err == nil) {
+				continue
+			}
+
+			if err != nil {
+				fmt.Fprintf(inv.Stderr, "%v\n", err)
+			}
+		}
+
+		err = exec(ctx, inv, link.pipeline)
+		shell.setLastError(err)
+	}
+	return err
+}
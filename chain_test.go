@@ -0,0 +1,137 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func parseChainLine(line string) (chain, error) {
+	tokens, err := lex(line, shellOperators)
+	if err != nil {
+		return nil, err
+	}
+	return parseChain(tokens)
+}
+
+var _ = Describe("chain", func() {
+	Describe("parsing", func() {
+		It("Should split the line into pipelines", func() {
+			c, err := parseChainLine("a | include x; b && c || d")
+			Expect(err).To(BeNil())
+			Expect(c).To(Equal(chain{
+				{pipeline: &pipeline{stages: [][]string{{"a"}, {"include", "x"}}}},
+				{operator: ";", pipeline: &pipeline{stages: [][]string{{"b"}}}},
+				{operator: "&&", pipeline: &pipeline{stages: [][]string{{"c"}}}},
+				{operator: "||", pipeline: &pipeline{stages: [][]string{{"d"}}}},
+			}))
+		})
+
+		It("Should allow a trailing semicolon", func() {
+			c, err := parseChainLine("a;")
+			Expect(err).To(BeNil())
+			Expect(c).To(HaveLen(1))
+		})
+
+		It("Should return an error for a missing command", func() {
+			for _, line := range []string{"; a", "a;;b", "a &&", "|| a", "a && ;"} {
+				_, err := parseChainLine(line)
+				Expect(err).To(MatchError(ErrEmptyCommand), line)
+			}
+		})
+
+		It("Should return pipeline errors", func() {
+			_, err := parseChainLine("a > ; b")
+			Expect(err).To(MatchError(ErrInvalidRedirect))
+		})
+	})
+
+	Describe("execution", func() {
+		var shell *Shell
+		var stdout, stderr bytes.Buffer
+
+		BeforeEach(func() {
+			shell = NewShell(CommandMap{
+				"echo": CommandFunc(echoCommand),
+				"fail": CommandFunc(func(ctx context.Context, inv *Invocation) error {
+					return errors.New("failed")
+				}),
+			})
+			stdout.Reset()
+			stderr.Reset()
+			shell.SetOutputWriter(&stdout)
+			shell.SetErrorWriter(&stderr)
+		})
+
+		execLine := func(line string) error {
+			return shell.execLine(context.Background(), shell.invocation(), line)
+		}
+
+		It("Should run every command separated by semicolons", func() {
+			Expect(execLine("fail; echo one; echo two")).To(Succeed())
+			Expect(stdout.String()).To(Equal("one\ntwo\n"))
+			Expect(stderr.String()).To(Equal("failed\n"))
+		})
+
+		It("Should only run the command after && when the previous command succeeded", func() {
+			Expect(execLine("echo one && echo two")).To(Succeed())
+			Expect(execLine("fail && echo three")).To(MatchError("failed"))
+			Expect(stdout.String()).To(Equal("one\ntwo\n"))
+			Expect(stderr.String()).To(BeEmpty())
+		})
+
+		It("Should only run the command after || when the previous command failed", func() {
+			Expect(execLine("echo one || echo two")).To(Succeed())
+			Expect(execLine("fail || echo three")).To(Succeed())
+			Expect(stdout.String()).To(Equal("one\nthree\n"))
+			Expect(stderr.String()).To(Equal("failed\n"))
+		})
+
+		It("Should carry the status past skipped commands", func() {
+			Expect(execLine("fail && echo one || echo two")).To(Succeed())
+			Expect(execLine("echo three || fail && echo four")).To(Succeed())
+			Expect(stdout.String()).To(Equal("two\nthree\nfour\n"))
+		})
+
+		It("Should not run the rest of the chain once the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			shell.commands.Add("interrupt", CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				cancel()
+				return ctx.Err()
+			}))
+
+			err := shell.execLine(ctx, shell.invocation(), "interrupt; echo one || echo two")
+			Expect(err).To(Equal(context.Canceled))
+			Expect(stdout.String()).To(BeEmpty())
+			Expect(stderr.String()).To(BeEmpty())
+		})
+
+		It("Should track the error of the last command", func() {
+			execLine("echo one; fail")
+			Expect(shell.LastError()).To(MatchError("failed"))
+			execLine("fail || echo two")
+			Expect(shell.LastError()).To(BeNil())
+			execLine(`echo "open`)
+			Expect(shell.LastError()).To(MatchError(ErrUnterminatedQuote))
+		})
+	})
+})
@@ -17,28 +17,91 @@
 package gosh
 
 import (
+	"context"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Completable is the interface for making a Command auto-completable
 //
 // Completions returns a slice of strings representing the list of completion
-// candidates.  The method is called with the field immediately following the
-// command.  For instance.  If the command being completed is "ls
-// /has/cheesburger" Then the Completion method for ls will be provided the
-// string /has/cheeseburger
+// candidates.  The method is called with the field being completed, which is
+// any of the arguments that follow the command.  For instance.  If the
+// command being completed is "ls /has/cheesburger" Then the Completion method
+// for ls will be provided the string /has/cheeseburger.  Commands whose
+// candidates depend on the preceding arguments should implement
+// ArgumentCompletable instead
 type Completable interface {
 	Completions(field string) []string
 }
 
+// CompletionRequest describes the argument being completed
+//
+// Path is the list of command names that lead to the command, Args are the
+// arguments, including any flags, that were typed between the path and the
+// word being completed, and Word is the partial word under the cursor.  The
+// values have been unquoted.  Line is the complete input line and Pos is the
+// position of the cursor within it.  For instance, completing
+// "route add 10.0.0.0/8 via 192.0.2.1 dev e" results in a Path of
+// []string{"route", "add"}, Args of
+// []string{"10.0.0.0/8", "via", "192.0.2.1", "dev"} and a Word of "e"
+type CompletionRequest struct {
+	Path []string
+	Args []string
+	Word string
+	Line string
+	Pos  int
+}
+
+// ArgumentCompletable is the interface for commands that complete each
+// argument based on the arguments that precede it
+//
+// CompleteArgument returns the completion candidates for the request.  Only
+// the candidates that begin with the request's Word are offered.  A command
+// that implements both ArgumentCompletable and Completable is completed with
+// CompleteArgument
+type ArgumentCompletable interface {
+	CompleteArgument(request *CompletionRequest) []string
+}
+
+// TimeoutCommand is the interface for commands that limit how long they may
+// execute
+//
+// Timeout returns the longest time the command is allowed to run.  It takes
+// precedence over the Timeout of the Invocation.  A zero duration means the
+// command is not limited.  When the timeout expires the context given to
+// Exec is cancelled, and a command that has not returned by the end of the
+// Shell's grace period is abandoned
+type TimeoutCommand interface {
+	Timeout() time.Duration
+}
+
+// commandTimeout returns the timeout that applies when command is executed
+// by inv
+func commandTimeout(command Command, inv *Invocation) time.Duration {
+	if tc, ok := command.(TimeoutCommand); ok {
+		if timeout := tc.Timeout(); timeout > 0 {
+			return timeout
+		}
+	}
+	return inv.Timeout
+}
+
 // TreeCommand is a concrete implementation of Command
 //
 // TreeCommand provides the ability to create a hierarchy of commands.  This
 // type of command hierarchy is very common in command line interfaces for
 // network appliances such as router and firewalls (think JunOS or Cisco IOS)
+//
+// The names of the sub-commands are indexed so that commands can be found and
+// completed quickly even in trees with tens of thousands of commands
 type TreeCommand struct {
 	subCommands CommandMap
+	index       *commandIndex
+	description Description
+	privilege   int
 }
 
 // SubCommands returns the CommandMap of sub commands that belong to this
@@ -47,8 +110,33 @@ func (t TreeCommand) SubCommands() CommandMap {
 	return t.subCommands
 }
 
+// Describe returns the description given to WithDescription
+func (t TreeCommand) Describe() Description {
+	return t.description
+}
+
+// WithDescription returns a copy of the TreeCommand with the given
+// description.  The copy shares the sub-commands of the original
+func (t TreeCommand) WithDescription(description Description) TreeCommand {
+	t.description = description
+	return t
+}
+
+// Privilege returns the privilege level given to WithPrivilege
+func (t TreeCommand) Privilege() int {
+	return t.privilege
+}
+
+// WithPrivilege returns a copy of the TreeCommand that requires the given
+// privilege level.  The level also applies to every sub-command.  The copy
+// shares the sub-commands of the original
+func (t TreeCommand) WithPrivilege(level int) TreeCommand {
+	t.privilege = level
+	return t
+}
+
 // Exec does nothing since a TreeCommand only contains sub-commands
-func (t TreeCommand) Exec() error {
+func (t TreeCommand) Exec(ctx context.Context, inv *Invocation) error {
 	return nil
 }
 
@@ -61,6 +149,7 @@ func (t TreeCommand) Add(name string, command Command) error {
 func NewTreeCommand(commands CommandMap) TreeCommand {
 	tree := TreeCommand{
 		subCommands: commands,
+		index:       newCommandIndex(commands),
 	}
 	return tree
 }
@@ -68,13 +157,69 @@ func NewTreeCommand(commands CommandMap) TreeCommand {
 // Command indicates that an object can be executed
 //
 // Exec should perform any computation necessary to execute the command that
-// provides the interface.  Prior to calling the Exec method, the shell will assign
-// the arguments to os.Args.  If the command is expecting any arguments, then they will
-// be availabe as os.Args.  The argument list includes the command path as os.Args[0]
+// provides the interface.  The context is cancelled when the command should
+// stop running.  The invocation carries the arguments that followed the
+// command on the prompt, the command path that was used to find the command
+// and the Shell that is executing it
 type Command interface {
+	Exec(ctx context.Context, inv *Invocation) error
+}
+
+// CommandFunc is an adapter to allow the use of ordinary functions as Commands
+type CommandFunc func(ctx context.Context, inv *Invocation) error
+
+// Exec calls f(ctx, inv)
+func (f CommandFunc) Exec(ctx context.Context, inv *Invocation) error {
+	return f(ctx, inv)
+}
+
+// LegacyCommand is the original gosh command interface
+//
+// Legacy commands receive their arguments through os.Args and write directly
+// to the process streams, so their output cannot be redirected.  Since
+// os.Args is global, legacy commands cannot run concurrently.  They can
+// still be added to a CommandMap by wrapping them with Legacy
+type LegacyCommand interface {
 	Exec() error
 }
 
+// legacyLock serializes legacy commands since they share os.Args
+var legacyLock sync.Mutex
+
+type legacyCommand struct {
+	command LegacyCommand
+}
+
+func (l legacyCommand) Exec(ctx context.Context, inv *Invocation) error {
+	legacyLock.Lock()
+	defer legacyLock.Unlock()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = make([]string, len(inv.Args)+1)
+	os.Args[0] = strings.Join(inv.Path, " ")
+	copy(os.Args[1:], inv.Args)
+	return l.command.Exec()
+}
+
+type legacyCompletableCommand struct {
+	legacyCommand
+	Completable
+}
+
+// Legacy adapts a LegacyCommand to the Command interface
+//
+// Prior to calling the legacy Exec method, os.Args is set to the command path
+// followed by the argument list and it is restored once Exec returns.  If the
+// legacy command is Completable then so is the returned Command
+func Legacy(command LegacyCommand) Command {
+	if completable, ok := command.(Completable); ok {
+		return legacyCompletableCommand{legacyCommand{command}, completable}
+	}
+	return legacyCommand{command}
+}
+
 // CommandMap is exactly what it sounds like.
 //
 // CommandMap is a map of Commands that are keyed by the command name that
@@ -85,42 +230,194 @@ type Command interface {
 // called
 type CommandMap map[string]Command
 
-func (commands CommandMap) getCompletions(field string) CommandMap {
+// getCompletions returns the commands whose names match field
+func (commands CommandMap) getCompletions(field string, matcher Matcher) CommandMap {
 	completions := make(CommandMap)
-	for completion, command := range commands {
-		if strings.HasPrefix(completion, field) {
-			completions[completion] = command
-		}
+	for _, completion := range matchingNames(commands, nil, field, matcher) {
+		completions[completion] = commands[completion]
 	}
 	return completions
 }
 
+// mergeCommands returns a CommandMap with the union of commands and
+// builtins.  If a name exists in both then the command is used
+func mergeCommands(commands, builtins CommandMap) CommandMap {
+	if len(builtins) == 0 {
+		return commands
+	}
+
+	merged := make(CommandMap, len(commands)+len(builtins))
+	for name, command := range builtins {
+		merged[name] = command
+	}
+
+	for name, command := range commands {
+		merged[name] = command
+	}
+	return merged
+}
+
 // Add a comand to the map
+//
+// Commands that are added to a map after it has been indexed, such as the
+// sub-commands of a TreeCommand, should be added with Add so that the index
+// follows them
 func (commands CommandMap) Add(commandName string, command Command) error {
 	if _, ok := commands[commandName]; ok {
 		return ErrDuplicateCommand
 	}
 	commands[commandName] = command
+	commandsAdded.Add(1)
 	return nil
 }
 
-// Find traverses the command map using the arguments slice and return the
-// Command whose path exactly matches the argument list.  If no Command can be
-// found with an exact matching path then ErrNoMatchingCommand is returned.
-func (commands CommandMap) Find(arguments []string) (Command, []string, error) {
-	var argument string
-	var i int
+// FindOption changes the way CommandMap.Find matches command names
+type FindOption func(*findOptions)
+
+type findOptions struct {
+	abbreviations bool
+	matcher       Matcher
+	authorize     func(path []string, command Command) error
+	index         *commandIndex
+}
+
+// AllowAbbreviations lets every command name in the path be abbreviated to any
+// prefix that uniquely identifies it.  A name that exactly matches a command
+// is never considered ambiguous, so "interface" still finds the interface
+// command even if an interfaces command also exists.  A prefix that matches
+// more than one command results in an *AmbiguousCommandError.  When used with
+// WithMatcher, an abbreviation is any word the Matcher matches and it
+// identifies the command with the best rank, so it is ambiguous when more
+// than one command shares that rank
+func AllowAbbreviations() FindOption {
+	return func(options *findOptions) {
+		options.abbreviations = true
+	}
+}
+
+// WithMatcher matches command names with matcher rather than PrefixMatch.
+// Without abbreviations, a name is only matched by a word with a rank of
+// zero, such as "SHOW" with CaseInsensitiveMatch
+func WithMatcher(matcher Matcher) FindOption {
+	return func(options *findOptions) {
+		options.matcher = matcher
+	}
+}
+
+// withAuthorization checks every command along the path with authorize and
+// returns its error instead of the command
+func withAuthorization(authorize func(path []string, command Command) error) FindOption {
+	return func(options *findOptions) {
+		options.authorize = authorize
+	}
+}
+
+// withIndex finds the first name of the path with index when the map being
+// searched is the first map of the index
+func withIndex(index *commandIndex) FindOption {
+	return func(options *findOptions) {
+		options.index = index
+	}
+}
+
+func newFindOptions(options []FindOption) findOptions {
+	var opts findOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	return opts
+}
+
+// match matches word to name with the Matcher, which is PrefixMatch unless
+// WithMatcher was given
+func (options findOptions) match(word, name string) (int, bool) {
+	if options.matcher == nil {
+		return PrefixMatch(word, name)
+	}
+	return options.matcher(word, name)
+}
+
+// permitted reports whether the command at path passes the authorization
+// given with withAuthorization
+func (options findOptions) permitted(path []string, command Command) bool {
+	return options.authorize == nil || options.authorize(path, command) == nil
+}
+
+// lookup returns the name and Command that the field refers to.  path is the
+// path of commands leading to the map and index is the index of the names in
+// commands, or nil if they are not indexed.  The commands are found in every
+// map of the index.  A command that is not permitted is never a candidate
+// for an abbreviation, so it cannot make the field ambiguous
+func (commands CommandMap) lookup(field string, path []string, index *commandIndex, options findOptions) (string, Command, error) {
+	if command := commandNamed(commands, index, field); command != nil {
+		return field, command, nil
+	} else if options.matcher == nil && !options.abbreviations {
+		return "", nil, ErrNoMatchingCommand
+	}
+
+	/* only the best ranked names are candidates,
+	 * and names that are not matched in full are
+	 * only candidates when abbreviations are allowed
+	 */
+	var candidates []string
+	best := 0
+	for _, name := range matchingNames(commands, index, field, options.matcher) {
+		rank, _ := options.match(field, name)
+		if rank > 0 && !options.abbreviations || len(candidates) > 0 && rank > best {
+			continue
+		}
+
+		command := commandNamed(commands, index, name)
+		if command == nil || !options.permitted(append(path[:len(path):len(path)], name), command) {
+			continue
+		}
+
+		if len(candidates) == 0 || rank < best {
+			best = rank
+			candidates = candidates[:0]
+		}
+
+		if rank == best {
+			candidates = append(candidates, name)
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0], commandNamed(commands, index, candidates[0]), nil
+	} else if len(candidates) > 1 {
+		return "", nil, &AmbiguousCommandError{Name: field, Candidates: candidates}
+	}
+	return "", nil, ErrNoMatchingCommand
+}
+
+// find traverses the command map and returns the path of command names that
+// were matched along with the Command and its arguments
+func (commands CommandMap) find(arguments []string, options findOptions) ([]string, Command, []string, error) {
+	var path []string
 	var command Command
+	var index *commandIndex
+	if options.index.indexes(commands) {
+		index = options.index
+	}
 
-	for i, argument = range arguments {
-		nextCommand := commands[argument]
-		if nextCommand == nil {
-			return nil, nil, ErrNoMatchingCommand
+	for len(arguments) > 0 {
+		name, nextCommand, err := commands.lookup(arguments[0], path, index, options)
+		if err != nil {
+			return nil, nil, nil, err
 		}
 
+		path = append(path, name)
+		if options.authorize != nil {
+			if err := options.authorize(path, nextCommand); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		arguments = arguments[1:]
 		command = nextCommand
 		if nextCommand, ok := nextCommand.(TreeCommand); ok {
 			commands = nextCommand.SubCommands()
+			index = nextCommand.index
 			if len(commands) == 0 {
 				break
 			}
@@ -128,25 +425,101 @@ func (commands CommandMap) Find(arguments []string) (Command, []string, error) {
 			break
 		}
 	}
-	return command, arguments[i+1:], nil
+
+	if command == nil {
+		return nil, nil, nil, ErrNoMatchingCommand
+	}
+	return path, command, arguments, nil
 }
 
-// Exec finds and execute a command corresponding to the argument list
-func (commands CommandMap) Exec(fields []string) error {
-	command, arguments, err := commands.Find(fields)
+// Find traverses the command map using the arguments slice and return the
+// Command whose path exactly matches the argument list.  If no Command can be
+// found with an exact matching path then ErrNoMatchingCommand is returned.
+// FindOptions, such as AllowAbbreviations, relax how the path is matched
+func (commands CommandMap) Find(arguments []string, options ...FindOption) (Command, []string, error) {
+	_, command, arguments, err := commands.find(arguments, newFindOptions(options))
+	return command, arguments, err
+}
+
+// Exec finds and executes a command corresponding to the argument list in
+// inv.Args
+//
+// The command is executed with a copy of inv where Path is set to the names
+// of the commands that were found and Args is set to the arguments that
+// followed them.  Any nil stream in the copy is set to the matching os stream
+//
+// If the command implements FlagCommand then its flags are parsed from the
+// arguments and any *FlagError is returned without executing the command.
+// If the command implements ParamCommand then the remaining arguments are
+// validated and any *ParamError is returned without executing the command.
+//
+// If the command implements TimeoutCommand, or inv.Timeout is set, then the
+// context is cancelled once the timeout expires and a *TimeoutError is
+// returned, whatever the command itself returns.  A command that ignores ctx
+// is abandoned if it has not returned by the end of the grace period of
+// inv.Shell, or DefaultGracePeriod when there is no Shell
+func (commands CommandMap) Exec(ctx context.Context, inv *Invocation, options ...FindOption) error {
+	path, command, arguments, err := commands.find(inv.Args, newFindOptions(options))
 
 	if err != nil {
 		return err
 	}
 
-	oldArgs := make([]string, len(os.Args))
-	copy(oldArgs, os.Args)
+	call := *inv
+	call.Path = path
+	call.Args = arguments
+	call.Flags = nil
+	call.Params = nil
+	call.setDefaultStreams()
 
-	defer func() { os.Args = oldArgs }()
-	os.Args = make([]string, len(arguments)+1)
-	os.Args[0] = strings.Join(fields[:len(fields)-len(arguments)], " ")
-	for i, argument := range arguments {
-		os.Args[i+1] = argument
+	if flags := commandFlags(command); flags != nil {
+		call.Flags, call.Args, err = parseFlags(flags, arguments)
+		if err != nil {
+			if flagErr, ok := err.(*FlagError); ok {
+				flagErr.Path = path
+			}
+			return err
+		}
+	}
+
+	if params := commandParams(command); params != nil {
+		call.Params, err = parseParams(params, call.Args)
+		if err != nil {
+			if paramErr, ok := err.(*ParamError); ok {
+				paramErr.Path = path
+			}
+			return err
+		}
+	}
+
+	timeout := commandTimeout(command, &call)
+	if timeout <= 0 {
+		return command.Exec(ctx, &call)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- command.Exec(timeoutCtx, &call)
+	}()
+
+	select {
+	case err = <-done:
+	case <-timeoutCtx.Done():
+		timer := time.NewTimer(call.Shell.abandonAfter())
+		defer timer.Stop()
+
+		select {
+		case err = <-done:
+		case <-timer.C:
+			err = timeoutCtx.Err()
+		}
+	}
+
+	if ctx.Err() == nil && timeoutCtx.Err() == context.DeadlineExceeded {
+		err = &TimeoutError{Path: path, Timeout: timeout}
 	}
-	return command.Exec()
+	return err
 }
@@ -17,15 +17,39 @@
 package gosh
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"os"
+	"time"
 )
 
+type legacyTestCommand struct {
+	arguments []string
+}
+
+func (l *legacyTestCommand) Exec() error {
+	l.arguments = make([]string, len(os.Args))
+	copy(l.arguments, os.Args)
+	return nil
+}
+
+type legacyCompletableTestCommand struct {
+	legacyTestCommand
+}
+
+func (l *legacyCompletableTestCommand) Completions(field string) []string {
+	return []string{"legacy"}
+}
+
 type testCommand struct {
 	completions  []string
 	executed     bool
+	path         []string
 	arguments    []string
+	invocation   *Invocation
 	execErr      error
 	execCallback func() error
 }
@@ -34,10 +58,11 @@ func (t *testCommand) Completions(substring string) []string {
 	return t.completions
 }
 
-func (t *testCommand) Exec() error {
+func (t *testCommand) Exec(ctx context.Context, inv *Invocation) error {
 	t.executed = true
-	t.arguments = make([]string, len(os.Args))
-	copy(t.arguments, os.Args)
+	t.invocation = inv
+	t.path = inv.Path
+	t.arguments = inv.Args
 	if t.execCallback != nil {
 		return t.execCallback()
 	}
@@ -58,6 +83,21 @@ func newTestCommand() *testCommand {
 	}
 }
 
+// slowCommand waits for its context to be done and declares timeout as its
+// own timeout when it is non-zero
+type slowCommand struct {
+	timeout time.Duration
+}
+
+func (s slowCommand) Exec(ctx context.Context, inv *Invocation) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s slowCommand) Timeout() time.Duration {
+	return s.timeout
+}
+
 func newCallbackCommand(callback func() error) *testCommand {
 	return &testCommand{
 		completions:  nil,
@@ -81,11 +121,11 @@ var _ = Describe("CommandMap", func() {
 
 	Describe("getCompletions", func() {
 		It("should return a CommandMap of all the commands when the field is blank", func() {
-			Expect(commands.getCompletions("")).To(Equal(commands))
+			Expect(commands.getCompletions("", PrefixMatch)).To(Equal(commands))
 		})
 
 		It("should return only those commands with matching prefixes", func() {
-			Expect(commands.getCompletions("j")).To(Equal(CommandMap{
+			Expect(commands.getCompletions("j", PrefixMatch)).To(Equal(CommandMap{
 				"john":  nil,
 				"james": nil,
 			}))
@@ -95,7 +135,7 @@ var _ = Describe("CommandMap", func() {
 	Describe("Add", func() {
 		It("Should add a new command to the map", func() {
 			Expect(commands.Add("rita", nil)).To(Succeed())
-			Expect(commands.getCompletions("")).To(Equal(CommandMap{
+			Expect(commands.getCompletions("", PrefixMatch)).To(Equal(CommandMap{
 				"john":  nil,
 				"james": nil,
 				"mary":  nil,
@@ -141,22 +181,183 @@ var _ = Describe("CommandMap", func() {
 
 	Describe("Exec", func() {
 		It("Should return an error if executing a command that can't be found", func() {
-			Expect(commands.Exec([]string{"invalid"})).To(MatchError(ErrNoMatchingCommand))
+			Expect(commands.Exec(context.Background(), &Invocation{Args: []string{"invalid"}})).To(MatchError(ErrNoMatchingCommand))
 		})
 
-		It("Should set os.Args to the program name and the argument list", func() {
-			cmd := newCallbackCommand(func() error {
-				Expect(os.Args).To(Equal([]string{"cmd", "arg1", "arg2"}))
-				return nil
-			})
+		It("Should pass the command path and the argument list in the invocation", func() {
+			cmd := newTestCommand()
+			commands.Add("cmd", cmd)
+			Expect(commands.Exec(context.Background(), &Invocation{Args: []string{"cmd", "arg1", "arg2"}})).To(Succeed())
+			Expect(cmd.path).To(Equal([]string{"cmd"}))
+			Expect(cmd.arguments).To(Equal([]string{"arg1", "arg2"}))
+		})
+
+		It("Should pass the shell in the invocation", func() {
+			cmd := newTestCommand()
 			commands.Add("cmd", cmd)
+			shell := NewShell(commands)
+			Expect(commands.Exec(context.Background(), &Invocation{Args: []string{"cmd"}, Shell: shell})).To(Succeed())
+			Expect(cmd.invocation.Shell).To(Equal(shell))
+		})
+
+		It("Should default any nil streams to the os streams", func() {
+			var stdout bytes.Buffer
+			cmd := newTestCommand()
+			commands.Add("cmd", cmd)
+			Expect(commands.Exec(context.Background(), &Invocation{Args: []string{"cmd"}, Stdout: &stdout})).To(Succeed())
+			Expect(cmd.invocation.Stdin).To(Equal(os.Stdin))
+			Expect(cmd.invocation.Stdout).To(Equal(&stdout))
+			Expect(cmd.invocation.Stderr).To(Equal(os.Stderr))
+		})
+
+		It("Should not modify os.Args", func() {
 			oldArgs := os.Args
-			Expect(commands.Exec([]string{"cmd", "arg1", "arg2"})).To(Succeed())
-			Expect(os.Args).To(Equal(oldArgs))
+			commands.Add("cmd", newCallbackCommand(func() error {
+				Expect(os.Args).To(Equal(oldArgs))
+				return nil
+			}))
+			Expect(commands.Exec(context.Background(), &Invocation{Args: []string{"cmd", "arg1"}})).To(Succeed())
+		})
+
+		It("Should return a timeout error when the invocation timeout expires", func() {
+			commands.Add("slow", NewTreeCommand(CommandMap{"cmd": slowCommand{}}))
+			err := commands.Exec(context.Background(), &Invocation{Args: []string{"slow", "cmd"}, Timeout: time.Millisecond})
+			Expect(errors.Is(err, ErrTimeout)).To(BeTrue())
+			Expect(err).To(Equal(&TimeoutError{Path: []string{"slow", "cmd"}, Timeout: time.Millisecond}))
+			Expect(err).To(MatchError("slow cmd: timed out after 1ms"))
+		})
+
+		It("Should prefer the timeout declared by the command", func() {
+			commands.Add("slow", slowCommand{timeout: time.Millisecond})
+			err := commands.Exec(context.Background(), &Invocation{Args: []string{"slow"}, Timeout: time.Hour})
+			Expect(err).To(Equal(&TimeoutError{Path: []string{"slow"}, Timeout: time.Millisecond}))
+		})
+
+		It("Should report a timeout when the command ignores the context and succeeds", func() {
+			commands.Add("sleep", newCallbackCommand(func() error {
+				time.Sleep(5 * time.Millisecond)
+				return nil
+			}))
+			err := commands.Exec(context.Background(), &Invocation{Args: []string{"sleep"}, Timeout: time.Millisecond})
+			Expect(err).To(Equal(&TimeoutError{Path: []string{"sleep"}, Timeout: time.Millisecond}))
+		})
+
+		It("Should abandon a command that ignores the context after the grace period", func() {
+			release := make(chan struct{})
+			defer close(release)
+			commands.Add("hang", newCallbackCommand(func() error {
+				<-release
+				return nil
+			}))
+
+			shell := NewShell(CommandMap{})
+			shell.SetGracePeriod(time.Millisecond)
+			err := commands.Exec(context.Background(), &Invocation{Args: []string{"hang"}, Shell: shell, Timeout: time.Millisecond})
+			Expect(err).To(Equal(&TimeoutError{Path: []string{"hang"}, Timeout: time.Millisecond}))
+		})
+
+		It("Should not report a timeout when the parent context is cancelled", func() {
+			commands.Add("slow", slowCommand{timeout: time.Millisecond})
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := commands.Exec(ctx, &Invocation{Args: []string{"slow"}})
+			Expect(err).To(Equal(context.Canceled))
 		})
 	})
 })
 
+var _ = Describe("Abbreviations", func() {
+	var commands CommandMap
+	var interfaceCmd, interfacesCmd, shutdownCmd *testCommand
+
+	BeforeEach(func() {
+		interfaceCmd = newTestCommand()
+		interfacesCmd = newTestCommand()
+		shutdownCmd = newTestCommand()
+		commands = CommandMap{
+			"show": NewTreeCommand(CommandMap{
+				"interface":  interfaceCmd,
+				"interfaces": interfacesCmd,
+				"time":       newTestCommand(),
+			}),
+			"shutdown": shutdownCmd,
+		}
+	})
+
+	It("Should not allow abbreviations by default", func() {
+		_, _, err := commands.Find([]string{"shut"})
+		Expect(err).To(MatchError(ErrNoMatchingCommand))
+	})
+
+	It("Should find a command by a unique prefix at every level", func() {
+		cmd, arguments, err := commands.Find([]string{"sho", "t", "arg"}, AllowAbbreviations())
+		Expect(err).To(BeNil())
+		Expect(cmd).To(Equal(commands["show"].(TreeCommand).SubCommands()["time"]))
+		Expect(arguments).To(Equal([]string{"arg"}))
+	})
+
+	It("Should prefer an exact match", func() {
+		cmd, _, err := commands.Find([]string{"sho", "interface", "eth0"}, AllowAbbreviations())
+		Expect(err).To(BeNil())
+		Expect(cmd).To(Equal(interfaceCmd))
+	})
+
+	It("Should return an ambiguous command error listing the candidates", func() {
+		_, _, err := commands.Find([]string{"sh", "time"}, AllowAbbreviations())
+		Expect(errors.Is(err, ErrAmbiguousCommand)).To(BeTrue())
+		Expect(err).To(MatchError(`ambiguous command "sh": show, shutdown`))
+
+		_, _, err = commands.Find([]string{"show", "int"}, AllowAbbreviations())
+		Expect(err).To(Equal(&AmbiguousCommandError{Name: "int", Candidates: []string{"interface", "interfaces"}}))
+	})
+
+	It("Should return an error when nothing matches the prefix", func() {
+		_, _, err := commands.Find([]string{"x"}, AllowAbbreviations())
+		Expect(err).To(MatchError(ErrNoMatchingCommand))
+	})
+
+	It("Should set the path to the full command names when executing", func() {
+		Expect(commands.Exec(context.Background(), &Invocation{Args: []string{"sho", "interfaces", "eth0"}}, AllowAbbreviations())).To(Succeed())
+		Expect(interfacesCmd.path).To(Equal([]string{"show", "interfaces"}))
+		Expect(interfacesCmd.arguments).To(Equal([]string{"eth0"}))
+	})
+})
+
+var _ = Describe("Legacy", func() {
+	It("Should set os.Args to the command path and the argument list", func() {
+		legacy := &legacyTestCommand{}
+		commands := CommandMap{
+			"tlc": NewTreeCommand(CommandMap{
+				"cmd": Legacy(legacy),
+			}),
+		}
+		oldArgs := os.Args
+		Expect(commands.Exec(context.Background(), &Invocation{Args: []string{"tlc", "cmd", "arg1", "arg2"}})).To(Succeed())
+		Expect(legacy.arguments).To(Equal([]string{"tlc cmd", "arg1", "arg2"}))
+		Expect(os.Args).To(Equal(oldArgs))
+	})
+
+	It("Should only be completable if the legacy command is", func() {
+		Expect(Legacy(&legacyTestCommand{})).ToNot(BeAssignableToTypeOf(legacyCompletableCommand{}))
+		command := Legacy(&legacyCompletableTestCommand{})
+		completable, ok := command.(Completable)
+		Expect(ok).To(BeTrue())
+		Expect(completable.Completions("")).To(Equal([]string{"legacy"}))
+	})
+})
+
+var _ = Describe("CommandFunc", func() {
+	It("Should call the function when executed", func() {
+		called := false
+		command := CommandFunc(func(ctx context.Context, inv *Invocation) error {
+			called = true
+			return nil
+		})
+		Expect(command.Exec(context.Background(), &Invocation{})).To(Succeed())
+		Expect(called).To(BeTrue())
+	})
+})
+
 var _ = Describe("TreeCommand", func() {
 	Describe("Finding a sub-command", func() {
 		var commands CommandMap
@@ -200,15 +401,15 @@ var _ = Describe("TreeCommand", func() {
 		})
 
 		It("Should return nil when executing", func() {
-			Expect(tlc.Exec()).To(BeNil())
+			Expect(tlc.Exec(context.Background(), &Invocation{})).To(BeNil())
 		})
 
-		It("Should set os.Args[0] to the full command path when executing the command", func() {
-			tlc.Add("subCmd3", newCallbackCommand(func() error {
-				Expect(os.Args).To(Equal([]string{"tlc subCmd3", "arg1", "arg2"}))
-				return nil
-			}))
-			Expect(commands.Exec([]string{"tlc", "subCmd3", "arg1", "arg2"})).To(Succeed())
+		It("Should set the path to the full command path when executing the command", func() {
+			cmd := newTestCommand()
+			tlc.Add("subCmd3", cmd)
+			Expect(commands.Exec(context.Background(), &Invocation{Args: []string{"tlc", "subCmd3", "arg1", "arg2"}})).To(Succeed())
+			Expect(cmd.path).To(Equal([]string{"tlc", "subCmd3"}))
+			Expect(cmd.arguments).To(Equal([]string{"arg1", "arg2"}))
 		})
 	})
 })
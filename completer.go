@@ -17,66 +17,424 @@
 package gosh
 
 import (
+	"fmt"
 	"sort"
 	"strings"
-	"unicode"
+	"sync"
+	"time"
 )
 
 type completer struct {
 	topLevelCommands CommandMap
+	builtins         CommandMap
+	filters          CommandMap
+	options          []FindOption
+	mode             *Mode
+	cache            *completionCache
+	top              *topLevelIndex
+	timeout          time.Duration
 }
 
 func newCompleter(commands CommandMap) *completer {
-	return &completer{commands}
+	return &completer{
+		topLevelCommands: commands,
+		cache:            newCompletionCache(),
+		top:              &topLevelIndex{},
+		timeout:          DefaultCompletionTimeout,
+	}
 }
 
-func (c completer) complete(line string, pos int) (string, []string, string) {
-	var candidates []string
+// topLevelIndex is the index of the top level commands and the builtins.  It
+// is kept until either map is replaced, such as when the mode changes
+type topLevelIndex struct {
+	lock  sync.Mutex
+	index *commandIndex
+}
+
+// topLevel returns the top level commands and the index of their names along
+// with the names of the builtins
+func (c completer) topLevel() (CommandMap, *commandIndex) {
+	c.top.lock.Lock()
+	defer c.top.lock.Unlock()
+	index := c.top.index
+	if index == nil || !sameMap(index.maps[0], c.topLevelCommands) || !sameMap(index.maps[1], c.builtins) {
+		index = newCommandIndex(c.topLevelCommands, c.builtins)
+		c.top.index = index
+	}
+	return index.maps[0], index
+}
+
+// Candidate is a possible value for the word being completed
+//
+// Description is an optional short description of the value, such as
+// "up, 10.0.0.1/24" for an interface name, and is displayed next to the value
+// when the candidates are listed.  Group is an optional heading, such as
+// "interfaces", that the candidate is listed under.  Candidates without a
+// group are listed first
+type Candidate struct {
+	Value       string
+	Description string
+	Group       string
+}
+
+// CandidateCompletable is the interface for commands that complete their
+// arguments with described and grouped candidates
+//
+// Candidates returns the completion candidates for the request.  Only the
+// candidates whose Value begins with the request's Word are offered.  A
+// command that implements CandidateCompletable is completed with Candidates
+// rather than with CompleteArgument or Completions
+type CandidateCompletable interface {
+	Candidates(request *CompletionRequest) []Candidate
+}
+
+// completion is the result of completing the word under the cursor
+//
+// head is the part of the line before the word and tail is the part after
+// the cursor.  command is the command that the word is an argument of, or the
+// last command found before the word.  path holds the names that led to the
+// command and args holds the arguments that follow them.  executable is set
+// when the line before the word is a complete command and incomplete is set
+// when the command did not provide its candidates in time
+type completion struct {
+	head       string
+	word       token
+	tail       string
+	candidates []Candidate
+	command    Command
+	path       []string
+	args       []string
+	executable bool
+	incomplete bool
+}
+
+// completeLine finds the candidates for the word under the cursor.  The
+// candidates are sorted and have not been quoted
+func (c completer) completeLine(line string, pos int) completion {
+	fullLine := line
 	tail := line[pos:]
 	line = line[:pos]
 
-	head := ""
-	fields := strings.Fields(line[:pos])
-	/* We need to make sure that there are empty fields
+	/* unterminated quotes and escapes are expected
+	 * since the line is still being typed
+	 */
+	tokens, _ := lex(line, shellOperators)
+
+	/* We need to make sure that there is an empty field
 	 * in the event of a blank line, or a line that ends
-	 * in a space.  Otherwise, there is nothing to attempt
-	 * to match on below
+	 * in a space or an operator.  Otherwise, there is
+	 * nothing to attempt to match on below
+	 */
+	if len(tokens) == 0 || tokens[len(tokens)-1].end < len(line) || tokens[len(tokens)-1].kind == operatorToken {
+		tokens = append(tokens, token{start: len(line), end: len(line)})
+	}
+
+	last := tokens[len(tokens)-1]
+	result := completion{
+		head: line[:last.start],
+		word: last,
+		tail: tail,
+	}
+
+	/* commands are the names that are valid in the
+	 * current position, they are nil once the line
+	 * has reached the arguments of a command
 	 */
-	if len(fields) == 0 {
-		fields = []string{""}
-	} else if unicode.IsSpace(rune(line[pos-1])) {
-		fields = append(fields, "")
-	}
-
-	commands := c.topLevelCommands
-	for i, field := range fields {
-		completions := commands.getCompletions(field)
-		for completion, command := range completions {
-			/* If it is an exact match then
-			 * continue to the next field
+	options := newFindOptions(c.options)
+	commands, index := c.topLevel()
+	group := ""
+	for _, token := range tokens[:len(tokens)-1] {
+		if token.kind == operatorToken {
+			/* a pipe is followed by a filter, a
+			 * redirection is followed by a file name
+			 * and anything else starts a new command
 			 */
-			if field == completion {
-				head = head + completion + " "
-				if treeCommand, ok := command.(TreeCommand); ok {
-					commands = treeCommand.SubCommands()
-					break
-				} else if completable, ok := command.(Completable); ok {
-					nextField := ""
-					if i < len(fields)-1 {
-						nextField = fields[i+1]
-					}
-					nextCompletions := completable.Completions(nextField)
-					commands = make(CommandMap, len(nextCompletions))
-					for _, nextCompletion := range nextCompletions {
-						commands[nextCompletion] = command
-					}
-					break
-				}
-			} else if i == len(fields)-1 {
-				candidates = append(candidates, completion)
+			result.command = nil
+			result.path = nil
+			result.args = nil
+			index = nil
+			switch {
+			case token.value == pipeOperator:
+				commands = c.filters
+				group = "filters"
+			case isChainOperator(token.value):
+				commands, index = c.topLevel()
+				group = ""
+			default:
+				commands = nil
 			}
+			continue
+		}
+
+		if commands == nil {
+			if result.command != nil {
+				result.args = append(result.args, token.value)
+			}
+			continue
+		}
+
+		var name string
+		name, result.command, _ = commands.lookup(token.value, result.path, index, options)
+		result.path = append(result.path, name)
+		if result.command != nil && !options.permitted(result.path, result.command) {
+			result.command = nil
+		}
+		commands = nil
+		index = nil
+		group = "commands"
+		if treeCommand, ok := result.command.(TreeCommand); ok {
+			commands = treeCommand.SubCommands()
+			index = treeCommand.index
+		}
+	}
+
+	flags := commandFlags(result.command)
+	previous := ""
+	if len(tokens) > 1 {
+		previous = tokens[len(tokens)-2].value
+	}
+
+	request := &CompletionRequest{
+		Path: result.path,
+		Args: result.args,
+		Word: last.value,
+		Line: fullLine,
+		Pos:  pos,
+	}
+
+	if commands != nil {
+		var candidates []Candidate
+		for _, name := range matchingNames(commands, index, last.value, options.matcher) {
+			command := commandNamed(commands, index, name)
+			if !options.permitted(append(result.path[:len(result.path):len(result.path)], name), command) {
+				continue
+			}
+			candidates = append(candidates, Candidate{Value: name, Description: describe(command).Summary, Group: c.commandGroup(name, group)})
+		}
+		result.candidates = matchCandidates(candidates, last.value, options.match)
+	} else if candidates, ok := flagCandidates(flags, previous, last.value); ok && len(flags) > 0 {
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Value < candidates[j].Value
+		})
+		result.candidates = candidates
+	} else if provider := completionProvider(result.command); provider != nil {
+		var candidates []Candidate
+		candidates, result.incomplete = c.cache.provide(c.mode, result.command, provider, request, c.timeout)
+		result.candidates = matchCandidates(candidates, last.value, options.match)
+	}
+
+	if result.command != nil && last.value == "" {
+		tree, ok := result.command.(TreeCommand)
+		result.executable = !ok || len(tree.SubCommands()) == 0
+	}
+	return result
+}
+
+// commandGroup returns the group that a command name is listed under.  An
+// empty group means the name is a top level command or a builtin
+func (c completer) commandGroup(name, group string) string {
+	if group != "" {
+		return group
+	} else if c.topLevelCommands[name] == nil {
+		return "builtins"
+	}
+	return "commands"
+}
+
+// stringCandidates converts values to candidates without descriptions
+func stringCandidates(values []string) []Candidate {
+	candidates := make([]Candidate, len(values))
+	for i, value := range values {
+		candidates[i] = Candidate{Value: value}
+	}
+	return candidates
+}
+
+// complete returns the candidates for the word under the cursor, quoted so
+// that they can replace the word in the line
+func (c completer) complete(line string, pos int) (string, []string, string) {
+	result := c.completeLine(line, pos)
+	return result.head, result.quoted(), result.tail
+}
+
+// completeWord returns the word that replaces the one under the cursor: the
+// candidate that completes it, or the longest prefix common to every
+// candidate.  When the word cannot be extended any further it is returned
+// unchanged along with a listing of the candidates formatted for a terminal
+// of the given width
+func (c completer) completeWord(line string, pos, width int) (head, word, tail, listing string) {
+	result := c.completeLine(line, pos)
+	head, tail = result.head, result.tail
+	candidates := result.quoted()
+	if len(candidates) == 0 {
+		if result.incomplete {
+			listing = incompleteNotice
+		}
+		return head, line[len(head):pos], tail, listing
+	}
+
+	word = candidates[0]
+	if len(candidates) == 1 {
+		/* close any open quote and move on to the next word */
+		if word[0] == '"' || word[0] == '\'' {
+			word += word[:1]
 		}
+		return head, word + " ", tail, ""
+	}
+
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, word) {
+			word = word[:len(word)-1]
+		}
+	}
+
+	if len(word) <= pos-len(head) {
+		listing = formatCandidates(result.candidates, width)
+		if result.incomplete {
+			listing += incompleteNotice
+		}
+		return head, line[len(head):pos], tail, listing
+	}
+	return head, word, tail, ""
+}
+
+// formatCandidates lists the candidates under a heading for each group.
+// Candidates without a group are listed first and the remaining groups are
+// listed in alphabetical order.  Groups with descriptions list one candidate
+// per line with the descriptions aligned, otherwise the values are arranged
+// in columns
+func formatCandidates(candidates []Candidate, width int) string {
+	groups := make(map[string][]Candidate)
+	names := []string{}
+	valueWidth := 0
+	for _, candidate := range candidates {
+		if _, found := groups[candidate.Group]; !found {
+			names = append(names, candidate.Group)
+		}
+		groups[candidate.Group] = append(groups[candidate.Group], candidate)
+		if len(candidate.Value) > valueWidth {
+			valueWidth = len(candidate.Value)
+		}
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		if name != "" {
+			fmt.Fprintf(&builder, "%s:\n", name)
+		}
+
+		described := false
+		values := []string{}
+		for _, candidate := range groups[name] {
+			values = append(values, candidate.Value)
+			described = described || candidate.Description != ""
+		}
+
+		if !described && name == "" {
+			builder.WriteString(formatColumns(values, width))
+			continue
+		} else if !described {
+			columns := formatColumns(values, width-2)
+			builder.WriteString("  " + strings.ReplaceAll(strings.TrimSuffix(columns, "\n"), "\n", "\n  ") + "\n")
+			continue
+		}
+
+		for _, candidate := range groups[name] {
+			line := fmt.Sprintf("  %-*s  %s", valueWidth, candidate.Value, candidate.Description)
+			builder.WriteString(strings.TrimRight(line, " "))
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
+
+// formatColumns arranges the items into as many columns as will fit in the
+// given width
+func formatColumns(items []string, width int) string {
+	columnWidth := 0
+	for _, item := range items {
+		if len(item) > columnWidth {
+			columnWidth = len(item)
+		}
+	}
+	columnWidth += 2
+
+	columns := 1
+	if width > columnWidth {
+		columns = width / columnWidth
+	}
+
+	var builder strings.Builder
+	for i, item := range items {
+		if (i+1)%columns == 0 || i == len(items)-1 {
+			builder.WriteString(item)
+			builder.WriteString("\n")
+		} else {
+			fmt.Fprintf(&builder, "%-*s", columnWidth, item)
+		}
+	}
+	return builder.String()
+}
+
+// quoted returns the values of the candidates quoted in the same way as the
+// word being completed
+func (result completion) quoted() []string {
+	var candidates []string
+	for _, candidate := range result.candidates {
+		if result.word.quote == 0 {
+			candidates = append(candidates, quoteField(candidate.Value, 0))
+		} else {
+			candidates = append(candidates, string(result.word.quote)+quoteField(candidate.Value, result.word.quote))
+		}
+	}
+	return candidates
+}
+
+// incompleteNotice is displayed along with candidates that are partial or
+// have expired
+const incompleteNotice = "% Candidates may be incomplete or out of date\n"
+
+// contextHelp lists the words that are valid at the cursor along with their
+// descriptions.  "<cr>" is listed when the line is already a complete
+// command
+func (c completer) contextHelp(line string, pos int) string {
+	result := c.completeLine(line, pos)
+	items := result.candidates
+
+	/* arguments that cannot be completed are
+	 * described by the usage of the command
+	 */
+	if len(items) == 0 && result.command != nil {
+		if usage := commandUsage(result.command); usage != "" {
+			items = append(items, Candidate{Value: usage})
+		}
+	}
+
+	if result.executable {
+		items = append(items, Candidate{Value: "<cr>"})
+	}
+
+	if len(items) == 0 {
+		return "% Unrecognized command\n"
+	}
+
+	width := 0
+	for _, item := range items {
+		if len(item.Value) > width {
+			width = len(item.Value)
+		}
+	}
+
+	var builder strings.Builder
+	for _, item := range items {
+		line := fmt.Sprintf("  %-*s  %s", width, item.Value, item.Description)
+		builder.WriteString(strings.TrimRight(line, " "))
+		builder.WriteString("\n")
+	}
+
+	if result.incomplete {
+		builder.WriteString(incompleteNotice)
 	}
-	sort.Strings(candidates)
-	return head, candidates, tail
+	return builder.String()
 }
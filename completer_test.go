@@ -117,6 +117,78 @@ var _ = Describe("completer", func() {
 		})
 	})
 
+	Describe("Filter completions", func() {
+		var c *completer
+		BeforeEach(func() {
+			c = newCompleter(CommandMap{
+				"show": NewTreeCommand(CommandMap{
+					"config": newTestCommand(),
+				}),
+			})
+			c.filters = DefaultFilters()
+		})
+
+		It("Should complete filters after a pipe", func() {
+			head, completions, _ := c.complete("show config | ", 14)
+			Expect(head).To(Equal("show config | "))
+			Expect(completions).To(Equal([]string{"append", "begin", "count", "exclude", "include", "no-more", "redirect", "section"}))
+		})
+
+		It("Should complete filters immediately following a pipe", func() {
+			head, completions, _ := c.complete("show config |c", 14)
+			Expect(head).To(Equal("show config |"))
+			Expect(completions).To(Equal([]string{"count"}))
+		})
+
+		It("Should not complete anything after a redirection", func() {
+			_, completions, _ := c.complete("show config > ", 14)
+			Expect(completions).To(BeEmpty())
+		})
+
+		It("Should not complete commands after a pipe", func() {
+			_, completions, _ := c.complete("show config | sh", 16)
+			Expect(completions).To(BeEmpty())
+		})
+
+		It("Should complete top level commands after a command separator", func() {
+			for _, line := range []string{"show config | count; sh", "show config && sh", "show config||sh"} {
+				head, completions, _ := c.complete(line, len(line))
+				Expect(head).To(Equal(line[:len(line)-2]))
+				Expect(completions).To(Equal([]string{"show"}))
+			}
+		})
+	})
+
+	Describe("Abbreviated command names", func() {
+		It("Should complete the next level of an abbreviated command", func() {
+			c := newCompleter(CommandMap{
+				"show": NewTreeCommand(CommandMap{
+					"interface": newTestCommand(),
+					"time":      newTestCommand(),
+				}),
+			})
+			_, completions, _ := c.complete("sh ", 3)
+			Expect(completions).To(BeEmpty())
+
+			c.options = []FindOption{AllowAbbreviations()}
+			head, completions, _ := c.complete("sh ", 3)
+			Expect(head).To(Equal("sh "))
+			Expect(completions).To(Equal([]string{"interface", "time"}))
+		})
+	})
+
+	Describe("Names that are prefixes of other names", func() {
+		It("Should offer both names when the field matches the shorter name", func() {
+			c := newCompleter(CommandMap{
+				"interface":  newTestCommand(),
+				"interfaces": newTestCommand(),
+			})
+			head, completions, _ := c.complete("interface", 9)
+			Expect(head).To(Equal(""))
+			Expect(completions).To(Equal([]string{"interface", "interfaces"}))
+		})
+	})
+
 	Describe("Simple command completions", func() {
 		var command *testCommand
 		var c *completer
@@ -149,6 +221,28 @@ var _ = Describe("completer", func() {
 			Expect(tail).To(Equal(""))
 		})
 
+		It("should complete arguments inside of an open quote", func() {
+			command.setCompletions([]string{"uplink to core", "uplink to edge", "downlink"})
+			head, completions, tail := c.complete(`cmd "up`, 7)
+			Expect(head).To(Equal("cmd "))
+			Expect(completions).To(Equal([]string{`"uplink to core`, `"uplink to edge`}))
+			Expect(tail).To(Equal(""))
+		})
+
+		It("should escape arguments that contain spaces", func() {
+			command.setCompletions([]string{"uplink to core"})
+			head, completions, _ := c.complete(`cmd up`, 6)
+			Expect(head).To(Equal("cmd "))
+			Expect(completions).To(Equal([]string{`uplink\ to\ core`}))
+		})
+
+		It("should complete the argument after a quoted argument", func() {
+			command.setCompletions([]string{"a b", "aarg1"})
+			head, completions, _ := c.complete(`cmd "a b" aa`, 12)
+			Expect(head).To(Equal(`cmd "a b" `))
+			Expect(completions).To(Equal([]string{"aarg1"}))
+		})
+
 		It("should return matching arguments for a given prefix", func() {
 			head, completions, tail := c.complete("cmd a", 5)
 			Expect(head).To(Equal("cmd "))
@@ -159,4 +253,166 @@ var _ = Describe("completer", func() {
 			Expect(tail).To(Equal(""))
 		})
 	})
+
+	Describe("Argument completions", func() {
+		var command *routeCommand
+		var c *completer
+
+		BeforeEach(func() {
+			command = &routeCommand{}
+			c = newCompleter(CommandMap{
+				"route": NewTreeCommand(CommandMap{
+					"add": command,
+				}),
+			})
+		})
+
+		It("Should give the command the path and preceding arguments", func() {
+			line := `route add 10.0.0.0/8 via "192.0.2.1" dev e`
+			c.complete(line, len(line))
+			Expect(command.request).To(Equal(&CompletionRequest{
+				Path: []string{"route", "add"},
+				Args: []string{"10.0.0.0/8", "via", "192.0.2.1", "dev"},
+				Word: "e",
+				Line: line,
+				Pos:  len(line),
+			}))
+		})
+
+		It("Should complete each argument based on the ones before it", func() {
+			_, completions, _ := c.complete("route add 10.0.0.0/8 ", 21)
+			Expect(completions).To(Equal([]string{"dev", "via"}))
+
+			_, completions, _ = c.complete("route add 10.0.0.0/8 via ", 25)
+			Expect(completions).To(Equal([]string{"192.0.2.1", "192.0.2.254"}))
+
+			_, completions, _ = c.complete("route add 10.0.0.0/8 via 192.0.2.1 dev e", 40)
+			Expect(completions).To(Equal([]string{"eth0", "eth1"}))
+		})
+
+		It("Should only give the arguments before the cursor", func() {
+			line := "route add 10.0.0.0/8 via 192.0.2.1"
+			c.complete(line, 21)
+			Expect(command.request.Args).To(Equal([]string{"10.0.0.0/8"}))
+			Expect(command.request.Pos).To(Equal(21))
+		})
+
+		It("Should canonicalize abbreviated paths", func() {
+			c.options = []FindOption{AllowAbbreviations()}
+			c.complete("ro a x ", 7)
+			Expect(command.request.Path).To(Equal([]string{"route", "add"}))
+			Expect(command.request.Args).To(Equal([]string{"x"}))
+		})
+
+		It("Should start a new request after a chain operator", func() {
+			line := "route add x; route add y "
+			c.complete(line, len(line))
+			Expect(command.request.Args).To(Equal([]string{"y"}))
+		})
+	})
+})
+
+// interfaceCommand completes its argument with described candidates
+type interfaceCommand struct {
+	testCommand
+}
+
+func (i *interfaceCommand) Candidates(request *CompletionRequest) []Candidate {
+	return []Candidate{
+		{Value: "eth1", Description: "down", Group: "interfaces"},
+		{Value: "eth0", Description: "up, 10.0.0.1/24", Group: "interfaces"},
+		{Value: "lo", Description: "up, 127.0.0.1/8", Group: "interfaces"},
+		{Value: "eth0", Description: "duplicate", Group: "interfaces"},
+	}
+}
+
+var _ = Describe("completer candidates", func() {
+	var c *completer
+
+	BeforeEach(func() {
+		c = newCompleter(CommandMap{
+			"show": NewTreeCommand(CommandMap{
+				"interface": &interfaceCommand{},
+			}),
+			"ping": &flagTestCommand{flags: pingFlags},
+		})
+		c.builtins = CommandMap{"help": CommandFunc(helpCommand)}
+		c.filters = CommandMap{"include": CommandFunc(echoCommand)}
+	})
+
+	It("Should keep the descriptions and groups of the candidates", func() {
+		result := c.completeLine("show interface eth", 18)
+		Expect(result.candidates).To(Equal([]Candidate{
+			{Value: "eth0", Description: "up, 10.0.0.1/24", Group: "interfaces"},
+			{Value: "eth1", Description: "down", Group: "interfaces"},
+		}))
+	})
+
+	It("Should group commands, builtins, filters and flags", func() {
+		groups := func(line string) map[string]string {
+			groups := make(map[string]string)
+			for _, candidate := range c.completeLine(line, len(line)).candidates {
+				groups[candidate.Value] = candidate.Group
+			}
+			return groups
+		}
+
+		Expect(groups("")).To(Equal(map[string]string{"help": "builtins", "ping": "commands", "show": "commands"}))
+		Expect(groups("show ")).To(Equal(map[string]string{"interface": "commands"}))
+		Expect(groups("show interface | ")).To(Equal(map[string]string{"include": "filters"}))
+		Expect(groups("ping --c")).To(Equal(map[string]string{"--count": "flags"}))
+	})
+})
+
+// routeCommand completes its arguments based on the keyword that precedes
+// them
+type routeCommand struct {
+	testCommand
+	request *CompletionRequest
+}
+
+func (r *routeCommand) CompleteArgument(request *CompletionRequest) []string {
+	r.request = request
+	if len(request.Args) == 0 {
+		return nil
+	}
+
+	switch request.Args[len(request.Args)-1] {
+	case "via":
+		return []string{"192.0.2.254", "192.0.2.1"}
+	case "dev":
+		return []string{"eth0", "eth1", "lo"}
+	}
+	return []string{"via", "dev"}
+}
+
+var _ = Describe("completer context help", func() {
+	var c *completer
+
+	BeforeEach(func() {
+		c = newCompleter(CommandMap{
+			"show": NewTreeCommand(CommandMap{
+				"interface": &describedCommand{description: Description{Summary: "Display an interface", Usage: "<name>"}},
+				"time":      newTestCommand(),
+			}).WithDescription(Description{Summary: "Display system information"}),
+		})
+	})
+
+	It("Should list commands with their descriptions", func() {
+		Expect(c.contextHelp("", 0)).To(Equal("  show  Display system information\n"))
+		Expect(c.contextHelp("show ", 5)).To(Equal("  interface  Display an interface\n  time\n"))
+	})
+
+	It("Should list the matching commands for a partial word", func() {
+		Expect(c.contextHelp("show t", 6)).To(Equal("  time\n"))
+	})
+
+	It("Should show the usage of commands that cannot complete their arguments", func() {
+		Expect(c.contextHelp("show interface ", 15)).To(Equal("  <name>\n  <cr>\n"))
+		Expect(c.contextHelp("show time ", 10)).To(Equal("  <cr>\n"))
+	})
+
+	It("Should report words that are not recognized", func() {
+		Expect(c.contextHelp("bogus ", 6)).To(Equal("% Unrecognized command\n"))
+	})
 })
@@ -0,0 +1,315 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/abates/gosh"
+)
+
+// Mode returns a gosh.Mode named "edit" whose commands edit the Store.
+// Configuration mode is usually entered with a configure command:
+//
+//	"configure": gosh.EnterMode(store.Mode())
+//
+// The compare filter returned by Filters must be added to the Shell for
+// show | compare to work
+func (store *Store) Mode() *gosh.Mode {
+	return &gosh.Mode{Name: "edit", Commands: store.Commands()}
+}
+
+// Commands returns the commands that edit the Store:
+//
+//	set <statement>...               add a statement to the candidate
+//	delete <statement>...            remove a statement from the candidate
+//	show                             display the candidate
+//	commit [check | confirmed <m>]   validate and commit the candidate
+//	rollback [revision]              load a revision into the candidate
+//
+// The arguments of set and delete are completed from the schema
+func (store *Store) Commands() gosh.CommandMap {
+	return gosh.CommandMap{
+		"commit":   commitCommand{store},
+		"delete":   statementCommand{store, true},
+		"rollback": rollbackCommand{store},
+		"set":      statementCommand{store, false},
+		"show":     showCommand{store},
+	}
+}
+
+// Filters returns the compare filter.  show | compare lists the differences
+// between the running and the candidate configurations and
+// show | compare rollback <n> compares the candidate with revision n
+func (store *Store) Filters() gosh.CommandMap {
+	return gosh.CommandMap{
+		"compare": compareCommand{store},
+	}
+}
+
+// statementCommand is the set command or, when delete is true, the delete
+// command
+type statementCommand struct {
+	store  *Store
+	delete bool
+}
+
+func (cmd statementCommand) Describe() gosh.Description {
+	if cmd.delete {
+		return gosh.Description{
+			Summary:  "Delete a statement from the candidate configuration",
+			Usage:    "<statement>...",
+			Examples: []string{"delete interfaces eth0 mtu"},
+		}
+	}
+	return gosh.Description{
+		Summary:  "Set a statement in the candidate configuration",
+		Usage:    "<statement>...",
+		Examples: []string{"set interfaces eth0 mtu 9000"},
+	}
+}
+
+func (cmd statementCommand) Exec(ctx context.Context, inv *gosh.Invocation) error {
+	if cmd.delete {
+		return cmd.store.Delete(inv.Args...)
+	}
+	return cmd.store.Set(inv.Args...)
+}
+
+// Candidates offers the statements that may follow the arguments.  delete
+// only offers the statements that are in the candidate configuration
+func (cmd statementCommand) Candidates(request *gosh.CompletionRequest) []gosh.Candidate {
+	tree := cmd.store.Candidate()
+	schema, n := tree.schema, tree.root
+	args := request.Args
+	for i := 0; i < len(args); i++ {
+		child := schema.Child(args[i])
+		if child == nil {
+			return nil
+		}
+		n = n.find(args[i])
+
+		if child.kind == containerKind {
+			schema = child
+			continue
+		} else if i+1 == len(args) {
+			return cmd.valueCandidates(child, n)
+		} else if child.kind == leafKind {
+			return nil
+		}
+
+		i++
+		n = n.find(args[i])
+		schema = child
+	}
+
+	var candidates []gosh.Candidate
+	for _, name := range schema.Children() {
+		if !cmd.delete || n.find(name) != nil {
+			candidates = append(candidates, gosh.Candidate{Value: name, Description: schema.Child(name).Help})
+		}
+	}
+	return candidates
+}
+
+// valueCandidates offers the keys of the entries of a list or the value of a
+// leaf
+func (cmd statementCommand) valueCandidates(schema *Schema, n *node) []gosh.Candidate {
+	var candidates []gosh.Candidate
+	if schema.kind == listKind {
+		for _, key := range n.keys() {
+			candidates = append(candidates, gosh.Candidate{Value: key})
+		}
+	} else if !cmd.delete && schema.param.Type == gosh.BoolValue {
+		candidates = append(candidates, gosh.Candidate{Value: "false"}, gosh.Candidate{Value: "true"})
+	} else if n != nil {
+		candidates = append(candidates, gosh.Candidate{Value: n.value})
+	}
+	return candidates
+}
+
+type showCommand struct {
+	store *Store
+}
+
+func (showCommand) Describe() gosh.Description {
+	return gosh.Description{
+		Summary:  "Display the candidate configuration",
+		Examples: []string{"show", "show | compare"},
+	}
+}
+
+func (showCommand) Params() []gosh.Param {
+	return []gosh.Param{}
+}
+
+func (cmd showCommand) Exec(ctx context.Context, inv *gosh.Invocation) error {
+	_, err := io.WriteString(inv.Stdout, cmd.store.Candidate().String())
+	return err
+}
+
+type commitCommand struct {
+	store *Store
+}
+
+func (commitCommand) Describe() gosh.Description {
+	return gosh.Description{
+		Summary: "Commit the candidate configuration",
+		Usage:   "[check | confirmed <minutes>]",
+		Help: "Validates the candidate and makes it the running configuration.  check " +
+			"only validates the candidate.  confirmed reverts to the previous " +
+			"configuration unless the commit is confirmed by another commit within " +
+			"the given number of minutes.",
+		Examples: []string{"commit", "commit check", "commit confirmed 5"},
+	}
+}
+
+func (commitCommand) Candidates(request *gosh.CompletionRequest) []gosh.Candidate {
+	if len(request.Args) > 0 {
+		return nil
+	}
+	return []gosh.Candidate{
+		{Value: "check", Description: "Validate the candidate without committing it"},
+		{Value: "confirmed", Description: "Revert unless confirmed within the given minutes"},
+	}
+}
+
+func (cmd commitCommand) Exec(ctx context.Context, inv *gosh.Invocation) error {
+	args := inv.Args
+	switch {
+	case len(args) == 0:
+		if err := cmd.store.Commit(); err != nil {
+			return err
+		}
+	case args[0] == "check" && len(args) == 1:
+		if err := cmd.store.Check(); err != nil {
+			return err
+		}
+		fmt.Fprintln(inv.Stdout, "configuration check succeeds")
+		return nil
+	case args[0] == "confirmed" && len(args) <= 2:
+		minutes := 10
+		if len(args) == 2 {
+			param := gosh.Param{Name: "minutes", Type: gosh.IntValue, Min: 1, Max: 65535}
+			value, err := param.Parse(args[1])
+			if err != nil {
+				return err
+			}
+			minutes = value.(int)
+		}
+
+		if err := cmd.store.CommitConfirmed(time.Duration(minutes) * time.Minute); err != nil {
+			return err
+		}
+		fmt.Fprintf(inv.Stdout, "commit confirmed will be automatically rolled back in %d minutes unless confirmed\n", minutes)
+	default:
+		return &gosh.ParamError{Path: inv.Path, Value: args[0], Err: gosh.ErrUnexpectedArgument}
+	}
+	fmt.Fprintln(inv.Stdout, "commit complete")
+	return nil
+}
+
+type rollbackCommand struct {
+	store *Store
+}
+
+func (rollbackCommand) Describe() gosh.Description {
+	return gosh.Description{
+		Summary:  "Load a previously committed revision into the candidate configuration",
+		Help:     "Revision 0, the default, is the running configuration.",
+		Examples: []string{"rollback", "rollback 1"},
+	}
+}
+
+func (rollbackCommand) Params() []gosh.Param {
+	return gosh.MustParseParams("[revision:int]")
+}
+
+func (cmd rollbackCommand) Candidates(request *gosh.CompletionRequest) []gosh.Candidate {
+	if len(request.Args) > 0 {
+		return nil
+	}
+
+	var candidates []gosh.Candidate
+	for i := 0; i < cmd.store.Revisions(); i++ {
+		candidates = append(candidates, gosh.Candidate{Value: strconv.Itoa(i)})
+	}
+	return candidates
+}
+
+func (cmd rollbackCommand) Exec(ctx context.Context, inv *gosh.Invocation) error {
+	if err := cmd.store.Rollback(inv.Params.Int("revision")); err != nil {
+		return err
+	}
+	fmt.Fprintln(inv.Stdout, "load complete")
+	return nil
+}
+
+type compareCommand struct {
+	store *Store
+}
+
+func (compareCommand) Describe() gosh.Description {
+	return gosh.Description{
+		Summary:  "Compare the candidate configuration with a revision",
+		Usage:    "[rollback <revision>]",
+		Examples: []string{"show | compare", "show | compare rollback 1"},
+	}
+}
+
+func (compareCommand) Candidates(request *gosh.CompletionRequest) []gosh.Candidate {
+	if len(request.Args) > 0 {
+		return nil
+	}
+	return []gosh.Candidate{{Value: "rollback", Description: "Compare with a previous revision"}}
+}
+
+func (cmd compareCommand) Exec(ctx context.Context, inv *gosh.Invocation) error {
+	revision := 0
+	switch {
+	case len(inv.Args) == 2 && inv.Args[0] == "rollback":
+		param := gosh.Param{Name: "revision", Type: gosh.IntValue}
+		value, err := param.Parse(inv.Args[1])
+		if err != nil {
+			return err
+		}
+		revision = value.(int)
+	case len(inv.Args) > 0:
+		return &gosh.ParamError{Path: inv.Path, Value: inv.Args[0], Err: gosh.ErrUnexpectedArgument}
+	}
+
+	/* the output of the command before the pipe
+	 * is replaced by the differences
+	 */
+	if inv.Stdin != nil {
+		io.Copy(io.Discard, inv.Stdin)
+	}
+
+	diff, err := cmd.store.Compare(revision)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range diff {
+		fmt.Fprintln(inv.Stdout, line)
+	}
+	return nil
+}
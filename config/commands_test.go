@@ -0,0 +1,121 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/abates/gosh"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Commands", func() {
+	var store *Store
+	var shell *gosh.Shell
+	var stdout, stderr *bytes.Buffer
+
+	run := func(lines ...string) error {
+		stdout.Reset()
+		stderr.Reset()
+		return shell.RunScript(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+	}
+
+	values := func(candidates []gosh.Candidate) []string {
+		var values []string
+		for _, candidate := range candidates {
+			values = append(values, candidate.Value)
+		}
+		return values
+	}
+
+	BeforeEach(func() {
+		store = NewStore(testSchema())
+		shell = gosh.NewShell(gosh.CommandMap{"configure": gosh.EnterMode(store.Mode())})
+		for name, filter := range store.Filters() {
+			Expect(shell.AddFilter(name, filter)).To(Succeed())
+		}
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+		shell.SetOutputWriter(stdout)
+		shell.SetErrorWriter(stderr)
+		shell.SetStopOnError(true)
+	})
+
+	It("Should edit, compare and commit the configuration", func() {
+		Expect(run("configure", "set interfaces eth0 mtu 9000", "set system host-name r1", "show")).To(Succeed())
+		Expect(shell.Mode().Name).To(Equal("edit"))
+		Expect(stdout.String()).To(Equal("interfaces {\n    eth0 {\n        mtu 9000;\n    }\n}\nsystem {\n    host-name r1;\n}\n"))
+
+		Expect(run("show | compare")).To(Succeed())
+		Expect(stdout.String()).To(Equal("+ set interfaces eth0 mtu 9000\n+ set system host-name r1\n"))
+
+		Expect(run("commit", "delete system", "show | compare")).To(Succeed())
+		Expect(stdout.String()).To(Equal("commit complete\n- set system host-name r1\n"))
+
+		Expect(run("commit", "rollback 1", "show | compare rollback 1")).To(Succeed())
+		Expect(stdout.String()).To(Equal("commit complete\nload complete\n"))
+		Expect(store.Running().Lines()).To(Equal([]string{"set interfaces eth0 mtu 9000"}))
+		Expect(store.Candidate().Lines()).To(Equal([]string{"set interfaces eth0 mtu 9000", "set system host-name r1"}))
+	})
+
+	It("Should report invalid statements and commits", func() {
+		Expect(run("configure")).To(Succeed())
+		Expect(run("set interfaces eth0 mtu 10")).To(MatchError(gosh.ErrInvalidArgument))
+		Expect(run("delete system")).To(MatchError(ErrStatementNotFound))
+		Expect(run("rollback 3")).To(MatchError(ErrNoSuchRevision))
+		Expect(run("commit later")).To(MatchError(gosh.ErrUnexpectedArgument))
+		Expect(run("commit confirmed 0")).To(MatchError(gosh.ErrInvalidArgument))
+		Expect(run("show | compare rollback 2")).To(MatchError(ErrNoSuchRevision))
+	})
+
+	It("Should check and confirm commits", func() {
+		Expect(run("configure", "set system host-name r1", "commit check")).To(Succeed())
+		Expect(stdout.String()).To(Equal("configuration check succeeds\n"))
+		Expect(store.Revisions()).To(Equal(0))
+
+		Expect(run("commit confirmed 5")).To(Succeed())
+		Expect(stdout.String()).To(Equal("commit confirmed will be automatically rolled back in 5 minutes unless confirmed\ncommit complete\n"))
+		Expect(store.Pending()).To(BeTrue())
+
+		Expect(run("commit")).To(Succeed())
+		Expect(store.Pending()).To(BeFalse())
+	})
+
+	It("Should complete statements from the schema", func() {
+		set := store.Commands()["set"].(gosh.CandidateCompletable)
+		del := store.Commands()["delete"].(gosh.CandidateCompletable)
+		complete := func(command gosh.CandidateCompletable, args ...string) []string {
+			return values(command.Candidates(&gosh.CompletionRequest{Args: args}))
+		}
+
+		Expect(complete(set)).To(Equal([]string{"interfaces", "system"}))
+		Expect(set.Candidates(&gosh.CompletionRequest{})[1].Description).To(Equal("System parameters"))
+		Expect(complete(set, "interfaces")).To(BeEmpty())
+		Expect(complete(del)).To(BeEmpty())
+
+		Expect(store.Set("interfaces", "eth0", "mtu", "9000")).To(Succeed())
+		Expect(complete(set, "interfaces")).To(Equal([]string{"eth0"}))
+		Expect(complete(set, "interfaces", "eth0")).To(Equal([]string{"description", "disable", "mtu", "unit"}))
+		Expect(complete(set, "interfaces", "eth0", "disable")).To(Equal([]string{"false", "true"}))
+		Expect(complete(set, "interfaces", "eth0", "mtu")).To(Equal([]string{"9000"}))
+		Expect(complete(set, "interfaces", "eth0", "mtu", "9000")).To(BeEmpty())
+		Expect(complete(set, "routing")).To(BeEmpty())
+		Expect(complete(del)).To(Equal([]string{"interfaces"}))
+		Expect(complete(del, "interfaces", "eth0")).To(Equal([]string{"mtu"}))
+	})
+})
@@ -0,0 +1,57 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidRevision indicates that a persisted revision could not be
+	// loaded because one of its statements is not valid for the schema
+	ErrInvalidRevision = errors.New("invalid revision")
+
+	// ErrNoSuchRevision indicates that a rollback named a revision that has
+	// not been kept
+	ErrNoSuchRevision = errors.New("no such revision")
+
+	// ErrStatementNotFound indicates that a statement being deleted is not in
+	// the configuration
+	ErrStatementNotFound = errors.New("statement not found")
+
+	// ErrUnknownStatement indicates that a path named a statement that is not
+	// in the schema
+	ErrUnknownStatement = errors.New("unknown statement")
+)
+
+// StatementError is returned when a configuration path cannot be used.  Path
+// holds the words of the path up to and including the one that failed
+type StatementError struct {
+	Path []string
+	Err  error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Err, strings.Join(e.Path, " "))
+}
+
+// Unwrap returns the underlying error
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
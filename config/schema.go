@@ -0,0 +1,117 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package config
+
+import (
+	"sort"
+
+	"github.com/abates/gosh"
+)
+
+type schemaKind int
+
+const (
+	containerKind schemaKind = iota
+	listKind
+	leafKind
+)
+
+// Schema describes one statement of the configuration tree
+//
+// A container groups other statements, a list holds entries that are named
+// by a key, such as the name of an interface, and a leaf holds a single typed
+// value.  Schemas are built with Container, List and Leaf:
+//
+//	schema := config.Container("", "",
+//		config.List("interfaces", "Network interfaces", gosh.Param{Name: "name"},
+//			config.Leaf(gosh.Param{Name: "mtu", Type: gosh.IntValue, Min: 68, Max: 9216}, "Maximum transmission unit"),
+//		),
+//		config.Container("system", "System parameters",
+//			config.Leaf(gosh.Param{Name: "host-name"}, "Host name of the system"),
+//		),
+//	)
+type Schema struct {
+	Name     string
+	Help     string
+	kind     schemaKind
+	param    gosh.Param
+	children map[string]*Schema
+}
+
+// Container returns the schema of a statement that groups the children
+func Container(name, help string, children ...*Schema) *Schema {
+	return newSchema(name, help, containerKind, gosh.Param{}, children)
+}
+
+// List returns the schema of a statement whose entries are named by a key.
+// The key is converted and checked by the key parameter and each entry
+// contains the children
+func List(name, help string, key gosh.Param, children ...*Schema) *Schema {
+	return newSchema(name, help, listKind, key, children)
+}
+
+// Leaf returns the schema of a statement that holds a single value.  The
+// statement is named by the parameter and the value is converted and checked
+// by it
+func Leaf(value gosh.Param, help string) *Schema {
+	return newSchema(value.Name, help, leafKind, value, nil)
+}
+
+func newSchema(name, help string, kind schemaKind, param gosh.Param, children []*Schema) *Schema {
+	schema := &Schema{
+		Name:     name,
+		Help:     help,
+		kind:     kind,
+		param:    param,
+		children: make(map[string]*Schema),
+	}
+	for _, child := range children {
+		schema.children[child.Name] = child
+	}
+	return schema
+}
+
+// Child returns the schema of the child statement with the given name, or nil
+// if there is no such statement
+func (schema *Schema) Child(name string) *Schema {
+	return schema.children[name]
+}
+
+// Children returns the names of the child statements in alphabetical order
+func (schema *Schema) Children() []string {
+	names := make([]string, 0, len(schema.children))
+	for name := range schema.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsLeaf reports whether the statement holds a value
+func (schema *Schema) IsLeaf() bool {
+	return schema.kind == leafKind
+}
+
+// IsList reports whether the statement holds entries named by a key
+func (schema *Schema) IsList() bool {
+	return schema.kind == listKind
+}
+
+// Param returns the parameter of a leaf's value or a list's key
+func (schema *Schema) Param() gosh.Param {
+	return schema.param
+}
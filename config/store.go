@@ -0,0 +1,358 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abates/gosh"
+)
+
+// DefaultRevisions is the number of committed revisions that a Store keeps
+// for rollback
+const DefaultRevisions = 50
+
+// revisionPrefix is the prefix of the files that persisted revisions are
+// written to.  The running configuration is revisionPrefix + "0"
+const revisionPrefix = "rollback."
+
+// Store holds the running configuration, the candidate configuration that is
+// being edited and the revisions that were previously committed
+//
+// Changes are made to the candidate and only take effect once they are
+// committed.  Each commit becomes revision 0 and the earlier revisions are
+// renumbered, so that revision 1 is always the configuration that was running
+// before the last commit.  A Store is safe for concurrent use
+type Store struct {
+	lock      sync.Mutex
+	schema    *Schema
+	candidate *Tree
+	revisions []*Tree
+	max       int
+	dir       string
+
+	validator func(candidate *Tree) error
+	hook      func(running *Tree)
+
+	/* confirm is the timer of a pending commit confirmed
+	 * and generation identifies it, so that a timer that
+	 * fires after being confirmed does nothing
+	 */
+	confirm    *time.Timer
+	generation int
+}
+
+// NewStore returns a Store for the schema that keeps its revisions in memory.
+// The running configuration is initially empty
+func NewStore(schema *Schema) *Store {
+	return &Store{
+		schema:    schema,
+		candidate: NewTree(schema),
+		max:       DefaultRevisions,
+	}
+}
+
+// OpenStore returns a Store that persists its revisions in dir.  Revisions
+// written by an earlier Store are loaded and the candidate starts out as the
+// running configuration
+func OpenStore(schema *Schema, dir string) (*Store, error) {
+	store := NewStore(schema)
+	store.dir = dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	for i := 0; ; i++ {
+		text, err := os.ReadFile(store.revisionFile(i))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		revision, err := Parse(schema, string(text))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", store.revisionFile(i), err)
+		}
+		store.revisions = append(store.revisions, revision)
+	}
+
+	if len(store.revisions) > 0 {
+		store.candidate = store.revisions[0].Clone()
+	}
+	return store, nil
+}
+
+// SetValidator sets the function that checks the candidate configuration
+// before it is committed.  An error returned by the validator aborts the
+// commit.  A nil validator generates the ErrNilCallback error
+func (store *Store) SetValidator(validator func(candidate *Tree) error) error {
+	if validator == nil {
+		return gosh.ErrNilCallback
+	}
+	store.lock.Lock()
+	store.validator = validator
+	store.lock.Unlock()
+	return nil
+}
+
+// SetCommitHook sets the function that is called with the new running
+// configuration after every commit, including the automatic revert of a
+// commit confirmed.  A nil hook generates the ErrNilCallback error
+func (store *Store) SetCommitHook(hook func(running *Tree)) error {
+	if hook == nil {
+		return gosh.ErrNilCallback
+	}
+	store.lock.Lock()
+	store.hook = hook
+	store.lock.Unlock()
+	return nil
+}
+
+// SetRevisions sets the number of revisions that are kept, including the
+// running configuration.  Older revisions are discarded at the next commit
+func (store *Store) SetRevisions(max int) {
+	if max < 1 {
+		max = 1
+	}
+	store.lock.Lock()
+	store.max = max
+	store.lock.Unlock()
+}
+
+// Schema returns the schema of the configuration
+func (store *Store) Schema() *Schema {
+	return store.schema
+}
+
+// Candidate returns a copy of the candidate configuration
+func (store *Store) Candidate() *Tree {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.candidate.Clone()
+}
+
+// Running returns a copy of the running configuration
+func (store *Store) Running() *Tree {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.revision(0).Clone()
+}
+
+// Revisions returns the number of revisions that can be rolled back to
+func (store *Store) Revisions() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return len(store.revisions)
+}
+
+// Revision returns a copy of revision n.  Revision 0 is the running
+// configuration.  ErrNoSuchRevision is returned if the revision is not kept
+func (store *Store) Revision(n int) (*Tree, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if n < 0 || n > 0 && n >= len(store.revisions) {
+		return nil, fmt.Errorf("%w %d", ErrNoSuchRevision, n)
+	}
+	return store.revision(n).Clone(), nil
+}
+
+// revision returns revision n, which must exist unless it is the running
+// configuration of a Store that has never been committed
+func (store *Store) revision(n int) *Tree {
+	if n >= len(store.revisions) {
+		return NewTree(store.schema)
+	}
+	return store.revisions[n]
+}
+
+// Set adds a statement to the candidate configuration
+func (store *Store) Set(path ...string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.candidate.Set(path...)
+}
+
+// Delete removes a statement from the candidate configuration
+func (store *Store) Delete(path ...string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.candidate.Delete(path...)
+}
+
+// Compare lists the differences between revision n and the candidate
+// configuration in the form returned by Diff
+func (store *Store) Compare(n int) ([]string, error) {
+	revision, err := store.Revision(n)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(revision, store.Candidate()), nil
+}
+
+// Rollback replaces the candidate configuration with revision n.  Rollback(0)
+// discards the uncommitted changes.  The rolled back configuration takes
+// effect once it is committed
+func (store *Store) Rollback(n int) error {
+	revision, err := store.Revision(n)
+	if err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	store.candidate = revision
+	store.lock.Unlock()
+	return nil
+}
+
+// Check runs the validator on the candidate configuration without committing
+// it
+func (store *Store) Check() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.check()
+}
+
+func (store *Store) check() error {
+	if store.validator == nil {
+		return nil
+	}
+	return store.validator(store.candidate.Clone())
+}
+
+// Commit validates the candidate configuration and makes it the running
+// configuration.  Committing also confirms a pending commit confirmed
+func (store *Store) Commit() error {
+	return store.commit(0)
+}
+
+// CommitConfirmed commits the candidate configuration and reverts to the
+// previous running configuration unless another commit is made within the
+// timeout.  The revert is itself committed as a new revision
+func (store *Store) CommitConfirmed(timeout time.Duration) error {
+	return store.commit(timeout)
+}
+
+func (store *Store) commit(timeout time.Duration) error {
+	store.lock.Lock()
+	if err := store.check(); err != nil {
+		store.lock.Unlock()
+		return err
+	}
+
+	running, err := store.push(store.candidate.Clone())
+	if err != nil {
+		store.lock.Unlock()
+		return err
+	}
+
+	if store.confirm != nil {
+		store.confirm.Stop()
+		store.confirm = nil
+	}
+	store.generation++
+
+	if timeout > 0 {
+		generation := store.generation
+		store.confirm = time.AfterFunc(timeout, func() { store.revert(generation) })
+	}
+	hook := store.hook
+	store.lock.Unlock()
+
+	if hook != nil {
+		hook(running)
+	}
+	return nil
+}
+
+// revert commits the configuration that was running before a commit
+// confirmed that was not confirmed in time
+func (store *Store) revert(generation int) {
+	store.lock.Lock()
+	if store.generation != generation {
+		store.lock.Unlock()
+		return
+	}
+	store.confirm = nil
+	store.generation++
+
+	previous := store.revision(1).Clone()
+	running, err := store.push(previous)
+	if err == nil {
+		store.candidate = previous.Clone()
+	}
+	hook := store.hook
+	store.lock.Unlock()
+
+	if err == nil && hook != nil {
+		hook(running)
+	}
+}
+
+// push makes tree revision 0, persisting it when the Store has a directory,
+// and returns a copy of it for the commit hook
+func (store *Store) push(tree *Tree) (*Tree, error) {
+	if store.dir != "" {
+		if err := store.persist(tree); err != nil {
+			return nil, err
+		}
+	}
+
+	store.revisions = append([]*Tree{tree}, store.revisions...)
+	if len(store.revisions) > store.max {
+		store.revisions = store.revisions[:store.max]
+	}
+	return tree.Clone(), nil
+}
+
+// persist renumbers the revision files and writes tree as revision 0
+func (store *Store) persist(tree *Tree) error {
+	temp := filepath.Join(store.dir, "."+revisionPrefix+"new")
+	text := strings.Join(tree.Lines(), "\n")
+	if text != "" {
+		text += "\n"
+	}
+	if err := os.WriteFile(temp, []byte(text), 0644); err != nil {
+		return err
+	}
+
+	for i := len(store.revisions) - 1; i >= 0; i-- {
+		if i+1 >= store.max {
+			os.Remove(store.revisionFile(i))
+		} else if err := os.Rename(store.revisionFile(i), store.revisionFile(i+1)); err != nil {
+			return err
+		}
+	}
+	return os.Rename(temp, store.revisionFile(0))
+}
+
+func (store *Store) revisionFile(n int) string {
+	return filepath.Join(store.dir, fmt.Sprintf("%s%d", revisionPrefix, n))
+}
+
+// Pending reports whether a commit confirmed is waiting to be confirmed
+func (store *Store) Pending() bool {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.confirm != nil
+}
@@ -0,0 +1,154 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abates/gosh"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var store *Store
+
+	BeforeEach(func() {
+		store = NewStore(testSchema())
+	})
+
+	It("Should only change the running configuration on commit", func() {
+		var committed []*Tree
+		Expect(store.SetCommitHook(func(running *Tree) { committed = append(committed, running) })).To(Succeed())
+		Expect(store.SetCommitHook(nil)).To(MatchError(gosh.ErrNilCallback))
+
+		Expect(store.Set("system", "host-name", "r1")).To(Succeed())
+		Expect(store.Running().Lines()).To(BeEmpty())
+		Expect(store.Compare(0)).To(Equal([]string{"+ set system host-name r1"}))
+
+		Expect(store.Commit()).To(Succeed())
+		Expect(store.Running().Lines()).To(Equal([]string{"set system host-name r1"}))
+		Expect(store.Compare(0)).To(BeEmpty())
+		Expect(committed).To(HaveLen(1))
+		Expect(committed[0].Lines()).To(Equal([]string{"set system host-name r1"}))
+	})
+
+	It("Should not commit a candidate that fails validation", func() {
+		invalid := errors.New("host-name is required")
+		Expect(store.SetValidator(func(candidate *Tree) error {
+			if _, found := candidate.Get("system", "host-name"); !found {
+				return invalid
+			}
+			return nil
+		})).To(Succeed())
+
+		Expect(store.Set("interfaces", "eth0", "mtu", "9000")).To(Succeed())
+		Expect(store.Check()).To(MatchError(invalid))
+		Expect(store.Commit()).To(MatchError(invalid))
+		Expect(store.Revisions()).To(Equal(0))
+
+		Expect(store.Set("system", "host-name", "r1")).To(Succeed())
+		Expect(store.Check()).To(Succeed())
+		Expect(store.Commit()).To(Succeed())
+		Expect(store.Revisions()).To(Equal(1))
+	})
+
+	It("Should roll back to earlier revisions", func() {
+		for _, name := range []string{"r1", "r2", "r3"} {
+			Expect(store.Set("system", "host-name", name)).To(Succeed())
+			Expect(store.Commit()).To(Succeed())
+		}
+		store.SetRevisions(2)
+		Expect(store.Set("system", "host-name", "r4")).To(Succeed())
+		Expect(store.Commit()).To(Succeed())
+		Expect(store.Revisions()).To(Equal(2))
+
+		Expect(store.Rollback(1)).To(Succeed())
+		Expect(store.Compare(0)).To(Equal([]string{
+			"+ set system host-name r3",
+			"- set system host-name r4",
+		}))
+		Expect(store.Running().Lines()).To(Equal([]string{"set system host-name r4"}))
+
+		Expect(store.Rollback(0)).To(Succeed())
+		Expect(store.Compare(0)).To(BeEmpty())
+		Expect(store.Rollback(2)).To(MatchError(ErrNoSuchRevision))
+		Expect(store.Rollback(-1)).To(MatchError(ErrNoSuchRevision))
+	})
+
+	It("Should persist revisions", func() {
+		dir, err := os.MkdirTemp("", "config")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		store, err = OpenStore(testSchema(), dir)
+		Expect(err).NotTo(HaveOccurred())
+		store.SetRevisions(3)
+		for _, name := range []string{"r1", "r2", "r3", "r4"} {
+			Expect(store.Set("system", "host-name", name)).To(Succeed())
+			Expect(store.Commit()).To(Succeed())
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dir, "rollback.*"))
+		Expect(files).To(HaveLen(3))
+		text, _ := os.ReadFile(filepath.Join(dir, "rollback.1"))
+		Expect(string(text)).To(Equal("set system host-name r3\n"))
+
+		reopened, err := OpenStore(testSchema(), dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.Revisions()).To(Equal(3))
+		Expect(reopened.Candidate().Lines()).To(Equal([]string{"set system host-name r4"}))
+		Expect(reopened.Rollback(2)).To(Succeed())
+		Expect(reopened.Candidate().Lines()).To(Equal([]string{"set system host-name r2"}))
+
+		Expect(os.WriteFile(filepath.Join(dir, "rollback.0"), []byte("set routing\n"), 0644)).To(Succeed())
+		_, err = OpenStore(testSchema(), dir)
+		Expect(err).To(MatchError(ErrUnknownStatement))
+	})
+
+	It("Should revert a commit confirmed that is not confirmed", func() {
+		reverted := make(chan *Tree, 1)
+		Expect(store.Set("system", "host-name", "r1")).To(Succeed())
+		Expect(store.Commit()).To(Succeed())
+		Expect(store.SetCommitHook(func(running *Tree) { reverted <- running })).To(Succeed())
+
+		Expect(store.Set("system", "host-name", "r2")).To(Succeed())
+		Expect(store.CommitConfirmed(10 * time.Millisecond)).To(Succeed())
+		Expect(store.Pending()).To(BeTrue())
+		Expect((<-reverted).Lines()).To(Equal([]string{"set system host-name r2"}))
+
+		Eventually(reverted).Should(Receive())
+		Expect(store.Pending()).To(BeFalse())
+		Expect(store.Running().Lines()).To(Equal([]string{"set system host-name r1"}))
+		Expect(store.Candidate().Lines()).To(Equal([]string{"set system host-name r1"}))
+		Expect(store.Revisions()).To(Equal(3))
+	})
+
+	It("Should keep a commit confirmed that is confirmed", func() {
+		Expect(store.Set("system", "host-name", "r1")).To(Succeed())
+		Expect(store.CommitConfirmed(20 * time.Millisecond)).To(Succeed())
+		Expect(store.Commit()).To(Succeed())
+		Expect(store.Pending()).To(BeFalse())
+
+		Consistently(func() []string { return store.Running().Lines() }, 50*time.Millisecond).Should(Equal([]string{"set system host-name r1"}))
+		Expect(store.Revisions()).To(Equal(2))
+	})
+})
@@ -0,0 +1,393 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/abates/gosh"
+)
+
+// node is a statement in a Tree.  Leaves hold a value, the children of a
+// list are its entries, named by their key, and the children of containers
+// and list entries are named by their statement
+type node struct {
+	value    string
+	children map[string]*node
+}
+
+func (n *node) child(name string, create bool) *node {
+	child := n.children[name]
+	if child == nil && create {
+		if n.children == nil {
+			n.children = make(map[string]*node)
+		}
+		child = &node{}
+		n.children[name] = child
+	}
+	return child
+}
+
+// find returns the named child, or nil if there is no such child.  It is
+// safe to call on a nil node
+func (n *node) find(name string) *node {
+	if n == nil {
+		return nil
+	}
+	return n.children[name]
+}
+
+// keys returns the names of the children and is safe to call on a nil node
+func (n *node) keys() []string {
+	if n == nil {
+		return nil
+	}
+	return n.names()
+}
+
+func (n *node) names() []string {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n *node) clone() *node {
+	c := &node{value: n.value}
+	for name, child := range n.children {
+		if c.children == nil {
+			c.children = make(map[string]*node)
+		}
+		c.children[name] = child.clone()
+	}
+	return c
+}
+
+// Tree is a configuration that conforms to a Schema
+//
+// Statements are addressed by the same words that are given to the set
+// command, for instance "interfaces", "eth0", "mtu", "9000".  A Tree is not
+// safe for concurrent modification
+type Tree struct {
+	schema *Schema
+	root   *node
+}
+
+// NewTree returns an empty configuration for the schema
+func NewTree(schema *Schema) *Tree {
+	return &Tree{schema: schema, root: &node{}}
+}
+
+// Schema returns the schema of the configuration
+func (tree *Tree) Schema() *Schema {
+	return tree.schema
+}
+
+// statement is a path that has been checked against the schema.  keys are
+// the names of the nodes along the path and schema is the schema of the last
+// node.  entry is set when the path ends with the key of a list entry and
+// value is only set when a leaf was followed by its value
+type statement struct {
+	keys     []string
+	schema   *Schema
+	entry    bool
+	value    string
+	hasValue bool
+}
+
+// resolve checks path against the schema.  Leaf values and list keys are
+// converted by their parameters so that only valid values are accepted
+func (tree *Tree) resolve(path []string) (statement, error) {
+	stmt := statement{schema: tree.schema}
+	for i := 0; i < len(path); i++ {
+		child := stmt.schema.Child(path[i])
+		if child == nil {
+			return stmt, &StatementError{Path: path[:i+1], Err: ErrUnknownStatement}
+		}
+		stmt.keys = append(stmt.keys, path[i])
+		stmt.schema = child
+		stmt.entry = false
+
+		if child.kind == containerKind || i+1 == len(path) {
+			continue
+		}
+
+		i++
+		if _, err := child.param.Parse(path[i]); err != nil {
+			if paramError, ok := err.(*gosh.ParamError); ok {
+				paramError.Path = path[:i]
+			}
+			return stmt, err
+		}
+
+		if child.kind == listKind {
+			stmt.keys = append(stmt.keys, path[i])
+			stmt.entry = true
+			continue
+		}
+
+		if i+1 < len(path) {
+			return stmt, &gosh.ParamError{Path: path[:i+1], Value: path[i+1], Err: gosh.ErrUnexpectedArgument}
+		}
+		stmt.value = path[i]
+		stmt.hasValue = true
+	}
+	return stmt, nil
+}
+
+// find returns the node named by keys, or nil if it is not in the tree
+func (tree *Tree) find(keys []string) *node {
+	n := tree.root
+	for _, key := range keys {
+		if n = n.child(key, false); n == nil {
+			break
+		}
+	}
+	return n
+}
+
+// Set adds the statement named by path to the configuration.  A leaf must be
+// followed by its value, which replaces any previous value.  A path that ends
+// with a container or a list entry adds an empty statement
+func (tree *Tree) Set(path ...string) error {
+	stmt, err := tree.resolve(path)
+	if err != nil {
+		return err
+	} else if len(stmt.keys) == 0 || stmt.schema.kind == listKind && !stmt.entry || stmt.schema.kind == leafKind && !stmt.hasValue {
+		return &StatementError{Path: path, Err: gosh.ErrMissingArgument}
+	}
+
+	n := tree.root
+	for _, key := range stmt.keys {
+		n = n.child(key, true)
+	}
+	n.value = stmt.value
+	return nil
+}
+
+// Delete removes the statement named by path along with every statement
+// below it.  A leaf may be given with or without its value.  Containers and
+// lists that are left empty are removed as well
+func (tree *Tree) Delete(path ...string) error {
+	stmt, err := tree.resolve(path)
+	if err != nil {
+		return err
+	} else if len(stmt.keys) == 0 {
+		return &StatementError{Path: path, Err: gosh.ErrMissingArgument}
+	}
+
+	n := tree.find(stmt.keys)
+	if n == nil || stmt.hasValue && n.value != stmt.value {
+		return &StatementError{Path: path, Err: ErrStatementNotFound}
+	}
+
+	/* remove the node and then any parent that is now
+	 * empty, stopping at list entries since an empty
+	 * entry is still a statement
+	 */
+	nodes := []*node{tree.root}
+	for i, key := range stmt.keys[:len(stmt.keys)-1] {
+		nodes = append(nodes, nodes[i].children[key])
+	}
+
+	for i := len(stmt.keys) - 1; i >= 0; i-- {
+		delete(nodes[i].children, stmt.keys[i])
+		if i == 0 || len(nodes[i].children) > 0 || isEntry(stmt.keys[:i], tree.schema) {
+			break
+		}
+	}
+	return nil
+}
+
+// isEntry reports whether keys name a list entry
+func isEntry(keys []string, schema *Schema) bool {
+	entry := false
+	for _, key := range keys {
+		if entry || schema.kind != listKind {
+			schema = schema.Child(key)
+			entry = false
+		} else {
+			entry = true
+		}
+	}
+	return entry
+}
+
+// Get returns the value of the leaf named by path converted to the type of
+// its parameter.  False is returned if the leaf is not set
+func (tree *Tree) Get(path ...string) (interface{}, bool) {
+	stmt, err := tree.resolve(path)
+	if err != nil || stmt.schema.kind != leafKind || stmt.hasValue {
+		return nil, false
+	}
+
+	n := tree.find(stmt.keys)
+	if n == nil {
+		return nil, false
+	}
+	value, err := stmt.schema.param.Parse(n.value)
+	return value, err == nil
+}
+
+// Keys returns the names of the statements directly below path in
+// alphabetical order.  For a list, these are the keys of its entries
+func (tree *Tree) Keys(path ...string) []string {
+	stmt, err := tree.resolve(path)
+	if err != nil {
+		return nil
+	}
+
+	n := tree.find(stmt.keys)
+	if n == nil {
+		return nil
+	}
+	return n.names()
+}
+
+// Clone returns a copy of the configuration
+func (tree *Tree) Clone() *Tree {
+	return &Tree{schema: tree.schema, root: tree.root.clone()}
+}
+
+// Lines returns the set commands that build the configuration
+func (tree *Tree) Lines() []string {
+	var lines []string
+	var walk func(n *node, schema *Schema, entries bool, path []string)
+	walk = func(n *node, schema *Schema, entries bool, path []string) {
+		for _, name := range n.names() {
+			child := n.children[name]
+			childSchema := schema
+			if !entries {
+				childSchema = schema.Child(name)
+			}
+			childPath := append(path[:len(path):len(path)], quote(name))
+
+			switch {
+			case !entries && childSchema.kind == leafKind:
+				lines = append(lines, "set "+strings.Join(childPath, " ")+" "+quote(child.value))
+			case len(child.children) == 0:
+				lines = append(lines, "set "+strings.Join(childPath, " "))
+			default:
+				walk(child, childSchema, !entries && childSchema.kind == listKind, childPath)
+			}
+		}
+	}
+	walk(tree.root, tree.schema, false, nil)
+	return lines
+}
+
+// String formats the configuration as nested blocks of statements
+func (tree *Tree) String() string {
+	var builder strings.Builder
+	var write func(n *node, schema *Schema, entries bool, indent string)
+	write = func(n *node, schema *Schema, entries bool, indent string) {
+		for _, name := range n.names() {
+			child := n.children[name]
+			childSchema := schema
+			if !entries {
+				childSchema = schema.Child(name)
+			}
+
+			switch {
+			case !entries && childSchema.kind == leafKind:
+				fmt.Fprintf(&builder, "%s%s %s;\n", indent, quote(name), quote(child.value))
+			case len(child.children) == 0:
+				fmt.Fprintf(&builder, "%s%s;\n", indent, quote(name))
+			default:
+				fmt.Fprintf(&builder, "%s%s {\n", indent, quote(name))
+				write(child, childSchema, !entries && childSchema.kind == listKind, indent+"    ")
+				fmt.Fprintf(&builder, "%s}\n", indent)
+			}
+		}
+	}
+	write(tree.root, tree.schema, false, "")
+	return builder.String()
+}
+
+// Diff lists the set commands that differ between two configurations.
+// Commands that are only in from are prefixed with "- " and commands that are
+// only in to are prefixed with "+ "
+func Diff(from, to *Tree) []string {
+	removed := make(map[string]bool)
+	for _, line := range from.Lines() {
+		removed[line] = true
+	}
+
+	var diff []string
+	for _, line := range to.Lines() {
+		if removed[line] {
+			delete(removed, line)
+		} else {
+			diff = append(diff, "+ "+line)
+		}
+	}
+
+	for line := range removed {
+		diff = append(diff, "- "+line)
+	}
+
+	sort.Slice(diff, func(i, j int) bool {
+		if diff[i][2:] == diff[j][2:] {
+			return diff[i] < diff[j]
+		}
+		return diff[i][2:] < diff[j][2:]
+	})
+	return diff
+}
+
+// Parse builds a configuration for the schema from set commands, one per
+// line.  Blank lines and lines starting with # are ignored
+func Parse(schema *Schema, text string) (*Tree, error) {
+	tree := NewTree(schema)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields, err := gosh.Split(line)
+		if err == nil && (len(fields) == 0 || fields[0] != "set") {
+			err = fmt.Errorf("%w: %s", ErrInvalidRevision, line)
+		} else if err == nil {
+			err = tree.Set(fields[1:]...)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tree, scanner.Err()
+}
+
+// quote returns value in a form that gosh.Split reads as a single field
+func quote(value string) string {
+	if value != "" && strings.IndexFunc(value, needsQuote) < 0 {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func needsQuote(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`'"\|>;&{}#`, r)
+}
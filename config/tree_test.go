@@ -0,0 +1,167 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"net"
+
+	"github.com/abates/gosh"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func testSchema() *Schema {
+	return Container("", "",
+		List("interfaces", "Network interfaces", gosh.Param{Name: "name"},
+			Leaf(gosh.Param{Name: "description"}, "Text description of the interface"),
+			Leaf(gosh.Param{Name: "disable", Type: gosh.BoolValue}, "Disable the interface"),
+			Leaf(gosh.Param{Name: "mtu", Type: gosh.IntValue, Min: 68, Max: 9216}, "Maximum transmission unit"),
+			List("unit", "Logical units", gosh.Param{Name: "number", Type: gosh.IntValue},
+				Leaf(gosh.Param{Name: "address", Type: gosh.IPValue}, "Interface address"),
+			),
+		),
+		Container("system", "System parameters",
+			Leaf(gosh.Param{Name: "host-name"}, "Host name of the system"),
+		),
+	)
+}
+
+var _ = Describe("Tree", func() {
+	var tree *Tree
+
+	BeforeEach(func() {
+		tree = NewTree(testSchema())
+	})
+
+	It("Should set and get typed values", func() {
+		Expect(tree.Set("interfaces", "eth0", "mtu", "9000")).To(Succeed())
+		Expect(tree.Set("interfaces", "eth0", "unit", "0", "address", "10.0.0.1")).To(Succeed())
+		Expect(tree.Set("system", "host-name", "r1")).To(Succeed())
+
+		value, found := tree.Get("interfaces", "eth0", "mtu")
+		Expect(found).To(BeTrue())
+		Expect(value).To(Equal(9000))
+
+		value, found = tree.Get("interfaces", "eth0", "unit", "0", "address")
+		Expect(found).To(BeTrue())
+		Expect(value.(net.IP).String()).To(Equal("10.0.0.1"))
+
+		_, found = tree.Get("interfaces", "eth1", "mtu")
+		Expect(found).To(BeFalse())
+		Expect(tree.Keys("interfaces")).To(Equal([]string{"eth0"}))
+		Expect(tree.Keys("interfaces", "eth0")).To(Equal([]string{"mtu", "unit"}))
+	})
+
+	It("Should reject statements that do not match the schema", func() {
+		tests := []struct {
+			path []string
+			want error
+			msg  string
+		}{
+			{[]string{"routing"}, ErrUnknownStatement, "unknown statement: routing"},
+			{[]string{"interfaces", "eth0", "speed", "10g"}, ErrUnknownStatement, "unknown statement: interfaces eth0 speed"},
+			{[]string{"interfaces", "eth0", "mtu", "10"}, gosh.ErrInvalidArgument, `interfaces eth0 mtu: invalid argument "10" for <mtu>: expected int 68-9216`},
+			{[]string{"interfaces", "eth0", "mtu", "1500", "extra"}, gosh.ErrUnexpectedArgument, `interfaces eth0 mtu 1500: unexpected argument "extra"`},
+			{[]string{"interfaces", "eth0", "unit", "zero"}, gosh.ErrInvalidArgument, `interfaces eth0 unit: invalid argument "zero" for <number>: expected int`},
+			{[]string{"interfaces", "eth0", "mtu"}, gosh.ErrMissingArgument, "missing argument: interfaces eth0 mtu"},
+			{[]string{"interfaces"}, gosh.ErrMissingArgument, "missing argument: interfaces"},
+			{nil, gosh.ErrMissingArgument, "missing argument: "},
+		}
+
+		for _, test := range tests {
+			err := tree.Set(test.path...)
+			Expect(errors.Is(err, test.want)).To(BeTrue(), "%v: %v", test.path, err)
+			Expect(err.Error()).To(Equal(test.msg))
+		}
+		Expect(tree.Lines()).To(BeEmpty())
+	})
+
+	It("Should delete statements and the containers they leave empty", func() {
+		Expect(tree.Set("interfaces", "eth0", "mtu", "9000")).To(Succeed())
+		Expect(tree.Set("interfaces", "eth0", "unit", "0", "address", "10.0.0.1")).To(Succeed())
+		Expect(tree.Set("system", "host-name", "r1")).To(Succeed())
+
+		Expect(tree.Delete("interfaces", "eth0", "mtu", "1500")).To(MatchError(ErrStatementNotFound))
+		Expect(tree.Delete("interfaces", "eth1")).To(MatchError(ErrStatementNotFound))
+
+		Expect(tree.Delete("interfaces", "eth0", "unit", "0", "address")).To(Succeed())
+		Expect(tree.Delete("interfaces", "eth0", "mtu", "9000")).To(Succeed())
+		Expect(tree.Delete("system", "host-name")).To(Succeed())
+		Expect(tree.Lines()).To(Equal([]string{
+			"set interfaces eth0 unit 0",
+		}))
+
+		Expect(tree.Delete("interfaces")).To(Succeed())
+		Expect(tree.Lines()).To(BeEmpty())
+	})
+
+	It("Should format the configuration as set commands and as blocks", func() {
+		Expect(tree.Set("interfaces", "eth0", "mtu", "9000")).To(Succeed())
+		Expect(tree.Set("interfaces", "eth0", "description", `uplink "a"`)).To(Succeed())
+		Expect(tree.Set("interfaces", "eth1")).To(Succeed())
+		Expect(tree.Set("system", "host-name", "r1")).To(Succeed())
+
+		Expect(tree.Lines()).To(Equal([]string{
+			`set interfaces eth0 description "uplink \"a\""`,
+			"set interfaces eth0 mtu 9000",
+			"set interfaces eth1",
+			"set system host-name r1",
+		}))
+
+		Expect(tree.String()).To(Equal(`interfaces {
+    eth0 {
+        description "uplink \"a\"";
+        mtu 9000;
+    }
+    eth1;
+}
+system {
+    host-name r1;
+}
+`))
+	})
+
+	It("Should parse the set commands that it writes", func() {
+		Expect(tree.Set("interfaces", "eth0", "description", "two words")).To(Succeed())
+		Expect(tree.Set("interfaces", "eth0", "unit", "0", "address", "10.0.0.1")).To(Succeed())
+
+		parsed, err := Parse(testSchema(), "# saved\n\n"+tree.Lines()[0]+"\n"+tree.Lines()[1]+"\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Lines()).To(Equal(tree.Lines()))
+
+		_, err = Parse(testSchema(), "delete interfaces\n")
+		Expect(err).To(MatchError(ErrInvalidRevision))
+	})
+
+	It("Should list the differences between configurations", func() {
+		Expect(tree.Set("interfaces", "eth0", "mtu", "1500")).To(Succeed())
+		Expect(tree.Set("system", "host-name", "r1")).To(Succeed())
+
+		changed := tree.Clone()
+		Expect(changed.Set("interfaces", "eth0", "mtu", "9000")).To(Succeed())
+		Expect(changed.Delete("system")).To(Succeed())
+		Expect(tree.Lines()).To(HaveLen(2))
+
+		Expect(Diff(tree, changed)).To(Equal([]string{
+			"- set interfaces eth0 mtu 1500",
+			"+ set interfaces eth0 mtu 9000",
+			"- set system host-name r1",
+		}))
+		Expect(Diff(tree, tree.Clone())).To(BeEmpty())
+	})
+})
@@ -18,9 +18,25 @@ package gosh
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
 var (
+	// ErrAmbiguousCommand indicates that an abbreviated command name matched
+	// more than one command.  The error returned is an *AmbiguousCommandError
+	// that matches ErrAmbiguousCommand with errors.Is
+	ErrAmbiguousCommand = errors.New("ambiguous command")
+
+	// ErrAuthenticationFailed indicates that the password given to enable was
+	// not accepted by the Shell's Authenticator
+	ErrAuthenticationFailed = errors.New("authentication failed")
+
+	// ErrCommandAbandoned indicates that an interrupted command did not return
+	// within the Shell's grace period
+	ErrCommandAbandoned = errors.New("command did not stop after interrupt and was abandoned")
+
 	// ErrDefaultPrompter indicates that the Prompt is not a DefaultPrompt so the
 	// prompter function cannot be overridden
 	ErrDefaultPrompter = errors.New("can only set the prompter on the DefaultPrompt")
@@ -29,6 +45,61 @@ var (
 	// in the CommandMap
 	ErrDuplicateCommand = errors.New("command already exists")
 
+	// ErrEmptyCommand indicates that ;, && or || was not both preceded and
+	// followed by a command
+	ErrEmptyCommand = errors.New("missing command in command list")
+
+	// ErrEmptyPipelineStage indicates that a pipe was not both preceded and
+	// followed by a command
+	ErrEmptyPipelineStage = errors.New("missing command in pipeline")
+
+	// ErrIncompleteCommand indicates that a command path named a TreeCommand
+	// rather than one of its sub-commands
+	ErrIncompleteCommand = errors.New("incomplete command")
+
+	// ErrInterrupted indicates that the user interrupted the prompt or the
+	// executing command
+	ErrInterrupted = errors.New("interrupted")
+
+	// ErrInvalidArgument indicates that an argument could not be converted to
+	// the type of its parameter or was outside of the parameter's range
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	// ErrInvalidFlagValue indicates that the value given for a flag could not
+	// be converted to the flag's type or was not one of its allowed values
+	ErrInvalidFlagValue = errors.New("invalid flag value")
+
+	// ErrInvalidParamSchema indicates that a parameter schema given to
+	// ParseParams could not be parsed
+	ErrInvalidParamSchema = errors.New("invalid parameter schema")
+
+	// ErrInvalidRedirect indicates that an output redirection was not followed
+	// by exactly one file name
+	ErrInvalidRedirect = errors.New("output redirection requires exactly one file name")
+
+	// ErrMisplacedBackground indicates that & appeared somewhere other than the
+	// end of a command line
+	ErrMisplacedBackground = errors.New("& is only allowed at the end of a command line")
+
+	// ErrMissingArgument indicates that a required parameter was not given
+	ErrMissingArgument = errors.New("missing argument")
+
+	// ErrMissingFileName indicates that a command was not given the single
+	// file name it requires
+	ErrMissingFileName = errors.New("a single file name is required")
+
+	// ErrMissingFlagValue indicates that a flag was the last argument but
+	// requires a value
+	ErrMissingFlagValue = errors.New("flag requires a value")
+
+	// ErrMissingJobID indicates that a job control command was not given the
+	// single job id it requires
+	ErrMissingJobID = errors.New("a single job id is required")
+
+	// ErrMissingPattern indicates that a filter was not given the pattern it
+	// requires
+	ErrMissingPattern = errors.New("missing pattern")
+
 	// ErrNilCallback indicates that a callback function was set to nil
 	ErrNilCallback = errors.New("cannot assign nil callback functions")
 
@@ -41,9 +112,200 @@ var (
 	// ErrNilPrompter indicates that the Prompt's prompter was set to nil
 	ErrNilPrompter = errors.New("cannot assign a nil prompter")
 
+	// ErrNilReader indicates the shell's reader was set to nil
+	ErrNilReader = errors.New("cannot assign a nil reader")
+
 	// ErrNilWriter indicates the shell's writer was set to nil
 	ErrNilWriter = errors.New("cannot assign a nil writer")
 
 	// ErrNoMatchingCommand indicates a matching command could not be found in the CommandMap
 	ErrNoMatchingCommand = errors.New("no matching command")
+
+	// ErrNoPasswordPrompt indicates that the Shell's Prompt cannot read a
+	// password without displaying it
+	ErrNoPasswordPrompt = errors.New("prompt cannot read passwords")
+
+	// ErrNoShell indicates that a command that requires a Shell was executed
+	// outside of one
+	ErrNoShell = errors.New("command must be executed by a shell")
+
+	// ErrNoSuchJob indicates that a job id did not match a background job.  The
+	// error returned is a *NoSuchJobError that matches ErrNoSuchJob with
+	// errors.Is
+	ErrNoSuchJob = errors.New("no such job")
+
+	// ErrPermissionDenied indicates that the user's privileges do not allow a
+	// command to be executed.  The error returned is a *PermissionError that
+	// matches ErrPermissionDenied with errors.Is
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrRedirectDenied indicates that the Shell's RedirectPolicy did not allow
+	// output to be written to a file
+	ErrRedirectDenied = errors.New("output redirection is not permitted")
+
+	// ErrRequiredFlag indicates that a required flag was not given
+	ErrRequiredFlag = errors.New("required flag not given")
+
+	// ErrScriptFailed indicates that one or more commands in a script failed
+	ErrScriptFailed = errors.New("script completed with errors")
+
+	// ErrScriptNesting indicates that scripts sourced other scripts too deeply,
+	// usually because a script sources itself
+	ErrScriptNesting = errors.New("scripts are nested too deeply")
+
+	// ErrTimeout indicates that a command did not complete within its timeout.
+	// The error returned is a *TimeoutError that matches ErrTimeout with
+	// errors.Is
+	ErrTimeout = errors.New("timed out")
+
+	// ErrUnexpectedArgument indicates that a command was given more arguments
+	// than it declares parameters
+	ErrUnexpectedArgument = errors.New("unexpected argument")
+
+	// ErrUnknownFlag indicates that an argument named a flag the command does
+	// not declare
+	ErrUnknownFlag = errors.New("unknown flag")
+
+	// ErrUnterminatedEscape indicates that an input line ended with a backslash
+	ErrUnterminatedEscape = errors.New("unterminated escape character")
+
+	// ErrUnterminatedQuote indicates that an input line ended inside of a quoted string
+	ErrUnterminatedQuote = errors.New("unterminated quoted string")
 )
+
+// AmbiguousCommandError indicates that an abbreviated command name matched
+// more than one command.  Candidates are the names that Name matched
+type AmbiguousCommandError struct {
+	Name       string
+	Candidates []string
+}
+
+func (e *AmbiguousCommandError) Error() string {
+	return fmt.Sprintf("%v %q: %s", ErrAmbiguousCommand, e.Name, strings.Join(e.Candidates, ", "))
+}
+
+// Is reports whether target is ErrAmbiguousCommand
+func (e *AmbiguousCommandError) Is(target error) bool {
+	return target == ErrAmbiguousCommand
+}
+
+// TimeoutError indicates that the command found at Path did not complete
+// within Timeout
+type TimeoutError struct {
+	Path    []string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: %v after %v", strings.Join(e.Path, " "), ErrTimeout, e.Timeout)
+}
+
+// Is reports whether target is ErrTimeout
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// PermissionError indicates that the command at Path may not be executed with
+// the user's privileges.  Err is the reason given by the Shell's Authorizer,
+// or nil if the command requires a higher privilege level or another role
+type PermissionError struct {
+	Path []string
+	Err  error
+}
+
+func (e *PermissionError) Error() string {
+	msg := fmt.Sprintf("%s: %v", strings.Join(e.Path, " "), ErrPermissionDenied)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is ErrPermissionDenied
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrPermissionDenied
+}
+
+// Unwrap returns the reason given by the Authorizer
+func (e *PermissionError) Unwrap() error {
+	return e.Err
+}
+
+// NoSuchJobError indicates that ID did not match a background job
+type NoSuchJobError struct {
+	ID string
+}
+
+func (e *NoSuchJobError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrNoSuchJob, e.ID)
+}
+
+// Is reports whether target is ErrNoSuchJob
+func (e *NoSuchJobError) Is(target error) bool {
+	return target == ErrNoSuchJob
+}
+
+// FlagError indicates that the flags given to the command at Path could not
+// be parsed.  Name is the flag as it was given, such as --count, and Err is
+// one of ErrInvalidFlagValue, ErrMissingFlagValue, ErrRequiredFlag or
+// ErrUnknownFlag.  For invalid values, Value is the value that was given and
+// Expected describes the values that are allowed
+type FlagError struct {
+	Path     []string
+	Name     string
+	Value    string
+	Expected string
+	Err      error
+}
+
+func (e *FlagError) Error() string {
+	msg := fmt.Sprintf("%v: %s", e.Err, e.Name)
+	if e.Expected != "" {
+		msg = fmt.Sprintf("%v %q for %s: expected %s", e.Err, e.Value, e.Name, e.Expected)
+	}
+
+	if len(e.Path) > 0 {
+		msg = strings.Join(e.Path, " ") + ": " + msg
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *FlagError) Unwrap() error {
+	return e.Err
+}
+
+// ParamError indicates that the arguments given to the command at Path did
+// not match its parameters.  Name is the name of the parameter, Value is the
+// argument that was given and Expected describes the type of the parameter.
+// Err is one of ErrInvalidArgument, ErrMissingArgument or
+// ErrUnexpectedArgument
+type ParamError struct {
+	Path     []string
+	Name     string
+	Value    string
+	Expected string
+	Err      error
+}
+
+func (e *ParamError) Error() string {
+	var msg string
+	switch e.Err {
+	case ErrMissingArgument:
+		msg = fmt.Sprintf("%v <%s>: expected %s", e.Err, e.Name, e.Expected)
+	case ErrUnexpectedArgument:
+		msg = fmt.Sprintf("%v %q", e.Err, e.Value)
+	default:
+		msg = fmt.Sprintf("%v %q for <%s>: expected %s", e.Err, e.Value, e.Name, e.Expected)
+	}
+
+	if len(e.Path) > 0 {
+		msg = strings.Join(e.Path, " ") + ": " + msg
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
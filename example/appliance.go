@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/abates/gosh"
 	"net"
@@ -10,9 +11,9 @@ import (
 
 type TimeCommand struct{}
 
-func (TimeCommand) Exec() error {
+func (TimeCommand) Exec(ctx context.Context, inv *gosh.Invocation) error {
 	t := time.Now()
-	fmt.Println(t.Format(time.RFC822))
+	fmt.Fprintln(inv.Stdout, t.Format(time.RFC822))
 	return nil
 }
 
@@ -31,6 +32,14 @@ func interfaceNames() ([]string, error) {
 
 type InterfaceCommand struct{}
 
+func (i InterfaceCommand) Describe() gosh.Description {
+	return gosh.Description{
+		Summary:  "Display the addresses of network interfaces",
+		Usage:    "<interface>...",
+		Examples: []string{"show interface eth0"},
+	}
+}
+
 func (i InterfaceCommand) Completions(substring string) []string {
 	names, err := interfaceNames()
 	if err != nil {
@@ -39,19 +48,23 @@ func (i InterfaceCommand) Completions(substring string) []string {
 	return names
 }
 
-func (i InterfaceCommand) Exec() error {
-	for _, name := range os.Args[1:] {
+func (i InterfaceCommand) CompletionTTL() time.Duration {
+	return 10 * time.Second
+}
+
+func (i InterfaceCommand) Exec(ctx context.Context, inv *gosh.Invocation) error {
+	for _, name := range inv.Args {
 		netInterface, err := net.InterfaceByName(name)
 		if err != nil {
 			return err
 		} else {
-			fmt.Printf("Name: %v\n", netInterface.Name)
+			fmt.Fprintf(inv.Stdout, "Name: %v\n", netInterface.Name)
 			addresses, err := netInterface.Addrs()
 			if err != nil {
 				return err
 			}
 			for _, address := range addresses {
-				fmt.Printf("      %v\n", address)
+				fmt.Fprintf(inv.Stdout, "      %v\n", address)
 			}
 		}
 	}
@@ -60,14 +73,18 @@ func (i InterfaceCommand) Exec() error {
 
 type InterfacesCommand struct{}
 
-func (i InterfacesCommand) Exec() error {
+func (i InterfacesCommand) Describe() gosh.Description {
+	return gosh.Description{Summary: "List the network interfaces"}
+}
+
+func (i InterfacesCommand) Exec(ctx context.Context, inv *gosh.Invocation) error {
 	names, err := interfaceNames()
 	if err != nil {
 		return err
 	}
 
 	for _, name := range names {
-		fmt.Fprintf(os.Stdout, "%v\n", name)
+		fmt.Fprintf(inv.Stdout, "%v\n", name)
 	}
 	return nil
 }
@@ -77,7 +94,7 @@ var commands = gosh.CommandMap{
 		"interface":  InterfaceCommand{},
 		"interfaces": InterfacesCommand{},
 		"time":       TimeCommand{},
-	}),
+	}).WithDescription(gosh.Description{Summary: "Display system information"}),
 }
 
 func main() {
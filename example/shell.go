@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/abates/gosh"
@@ -60,16 +61,16 @@ func isDir(path string) bool {
 	return fi.IsDir()
 }
 
-func (this cd) Exec() error {
+func (this cd) Exec(ctx context.Context, inv *gosh.Invocation) error {
 	nextDir := ""
-	if len(os.Args) == 1 {
+	if len(inv.Args) == 0 {
 		home := os.Getenv("HOME")
 		if home != "" {
 			cwd = home
 		}
 		return nil
 	}
-	dir := os.Args[1]
+	dir := inv.Args[0]
 	if dir[0] == '/' {
 		nextDir = string(dir[0])
 	} else {
@@ -84,7 +85,7 @@ func (this cd) Exec() error {
 
 type ls struct{}
 
-func (this ls) Exec() error {
+func (this ls) Exec(ctx context.Context, inv *gosh.Invocation) error {
 	f, err := os.Open(cwd)
 	defer f.Close()
 
@@ -93,7 +94,7 @@ func (this ls) Exec() error {
 	}
 	names, err := f.Readdirnames(0)
 	for _, name := range names {
-		fmt.Println(name)
+		fmt.Fprintln(inv.Stdout, name)
 	}
 	return nil
 }
@@ -0,0 +1,155 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// DefaultFilters returns a CommandMap of the built-in output filters
+//
+// Filters are the commands that may follow a pipe on the command line.  Each
+// filter reads the output of the previous command from its Stdin and writes
+// the filtered result to its Stdout.  The built-in filters are:
+//
+//	include <pattern>  only lines matching the regular expression
+//	exclude <pattern>  only lines not matching the regular expression
+//	begin <pattern>    every line starting with the first match
+//	section <pattern>  matching lines and the indented lines beneath them
+//	count [pattern]    the number of lines (matching the pattern)
+//	no-more            the output unchanged, without paging
+//	redirect <file>    nothing, the output is written to the file instead
+//	append <file>      nothing, the output is appended to the file instead
+//
+// The redirect and append filters are subject to the Shell's RedirectPolicy
+func DefaultFilters() CommandMap {
+	return CommandMap{
+		"include":  patternFilter(includeLines),
+		"exclude":  patternFilter(excludeLines),
+		"begin":    patternFilter(beginLines),
+		"section":  patternFilter(sectionLines),
+		"count":    CommandFunc(countLines),
+		"no-more":  CommandFunc(noMore),
+		"redirect": redirectFilter(false),
+		"append":   redirectFilter(true),
+	}
+}
+
+// lineFilter returns a function that decides whether each line of input,
+// in order, should be written to the output
+type lineFilter func(pattern *regexp.Regexp) func(line string) bool
+
+func includeLines(pattern *regexp.Regexp) func(string) bool {
+	return pattern.MatchString
+}
+
+func excludeLines(pattern *regexp.Regexp) func(string) bool {
+	return func(line string) bool {
+		return !pattern.MatchString(line)
+	}
+}
+
+func beginLines(pattern *regexp.Regexp) func(string) bool {
+	begun := false
+	return func(line string) bool {
+		begun = begun || pattern.MatchString(line)
+		return begun
+	}
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace))
+}
+
+func sectionLines(pattern *regexp.Regexp) func(string) bool {
+	inSection := false
+	sectionIndent := 0
+	return func(line string) bool {
+		indent := indentation(line)
+		if inSection && indent > sectionIndent {
+			return true
+		}
+
+		inSection = pattern.MatchString(line)
+		sectionIndent = indent
+		return inSection
+	}
+}
+
+func compilePattern(arguments []string) (*regexp.Regexp, error) {
+	if len(arguments) == 0 {
+		return nil, ErrMissingPattern
+	}
+	return regexp.Compile(strings.Join(arguments, " "))
+}
+
+func patternFilter(filter lineFilter) Command {
+	return CommandFunc(func(ctx context.Context, inv *Invocation) error {
+		pattern, err := compilePattern(inv.Args)
+		if err != nil {
+			return err
+		}
+
+		keep := filter(pattern)
+		scanner := bufio.NewScanner(inv.Stdin)
+		for scanner.Scan() {
+			if keep(scanner.Text()) {
+				if _, err := fmt.Fprintln(inv.Stdout, scanner.Text()); err != nil {
+					return err
+				}
+			}
+		}
+		return scanner.Err()
+	})
+}
+
+func countLines(ctx context.Context, inv *Invocation) error {
+	var pattern *regexp.Regexp
+	if len(inv.Args) > 0 {
+		var err error
+		if pattern, err = compilePattern(inv.Args); err != nil {
+			return err
+		}
+	}
+
+	count := 0
+	scanner := bufio.NewScanner(inv.Stdin)
+	for scanner.Scan() {
+		if pattern == nil || pattern.MatchString(scanner.Text()) {
+			count++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(inv.Stdout, "Count: %d lines\n", count)
+	return err
+}
+
+// noMore copies the output unchanged.  Output is never paged by gosh, so
+// no-more exists for operators that habitually type it
+func noMore(ctx context.Context, inv *Invocation) error {
+	_, err := io.Copy(inv.Stdout, inv.Stdin)
+	return err
+}
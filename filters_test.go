@@ -0,0 +1,89 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+)
+
+const testConfig = `hostname router
+interface eth0
+  description uplink
+  mtu 1500
+interface eth1
+  shutdown
+router bgp 65000
+  neighbor 10.0.0.1
+`
+
+func runFilter(input string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := DefaultFilters().Exec(context.Background(), &Invocation{
+		Args:   args,
+		Stdin:  strings.NewReader(input),
+		Stdout: &stdout,
+	})
+	return stdout.String(), err
+}
+
+var _ = Describe("DefaultFilters", func() {
+	It("include should only output matching lines", func() {
+		Expect(runFilter(testConfig, "include", "interface")).To(Equal("interface eth0\ninterface eth1\n"))
+	})
+
+	It("include should join its arguments into a single pattern", func() {
+		Expect(runFilter(testConfig, "include", "router", "bgp")).To(Equal("router bgp 65000\n"))
+	})
+
+	It("exclude should only output lines that do not match", func() {
+		Expect(runFilter(testConfig, "exclude", "^ ")).To(Equal("hostname router\ninterface eth0\ninterface eth1\nrouter bgp 65000\n"))
+	})
+
+	It("begin should output everything from the first match", func() {
+		Expect(runFilter(testConfig, "begin", "bgp")).To(Equal("router bgp 65000\n  neighbor 10.0.0.1\n"))
+	})
+
+	It("section should output matching lines and their children", func() {
+		Expect(runFilter(testConfig, "section", "eth1|bgp")).To(Equal("interface eth1\n  shutdown\nrouter bgp 65000\n  neighbor 10.0.0.1\n"))
+	})
+
+	It("count should output the number of lines", func() {
+		Expect(runFilter(testConfig, "count")).To(Equal("Count: 8 lines\n"))
+	})
+
+	It("count should output the number of matching lines", func() {
+		Expect(runFilter(testConfig, "count", "interface")).To(Equal("Count: 2 lines\n"))
+	})
+
+	It("no-more should output everything", func() {
+		Expect(runFilter(testConfig, "no-more")).To(Equal(testConfig))
+	})
+
+	It("should require a pattern", func() {
+		_, err := runFilter(testConfig, "include")
+		Expect(err).To(MatchError(ErrMissingPattern))
+	})
+
+	It("should return an error for an invalid pattern", func() {
+		_, err := runFilter(testConfig, "include", "(")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,358 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValueType is the type of a flag or parameter value
+type ValueType int
+
+const (
+	// StringValue accepts any string
+	StringValue ValueType = iota
+
+	// BoolValue accepts true or false.  A boolean flag given without a value
+	// is true
+	BoolValue
+
+	// IntValue accepts a base 10 integer
+	IntValue
+
+	// DurationValue accepts a duration such as 1m30s, see time.ParseDuration
+	DurationValue
+
+	// IPValue accepts an IPv4 or IPv6 address
+	IPValue
+)
+
+func (vt ValueType) String() string {
+	switch vt {
+	case StringValue:
+		return "string"
+	case BoolValue:
+		return "bool"
+	case IntValue:
+		return "int"
+	case DurationValue:
+		return "duration"
+	case IPValue:
+		return "ip"
+	}
+	return fmt.Sprintf("ValueType(%d)", int(vt))
+}
+
+// parse converts str to a value of the type
+func (vt ValueType) parse(str string) (interface{}, error) {
+	switch vt {
+	case BoolValue:
+		return strconv.ParseBool(str)
+	case IntValue:
+		return strconv.Atoi(str)
+	case DurationValue:
+		return time.ParseDuration(str)
+	case IPValue:
+		if ip := net.ParseIP(str); ip != nil {
+			return ip, nil
+		}
+		return nil, &net.ParseError{Type: "IP address", Text: str}
+	}
+	return str, nil
+}
+
+// Values holds the typed flag or parameter values given to a command by
+// name
+//
+// The accessors return the zero value when the name is not present or holds
+// a value of a different type
+type Values map[string]interface{}
+
+// String returns the named string value
+func (v Values) String(name string) string {
+	str, _ := v[name].(string)
+	return str
+}
+
+// Bool returns the named boolean value
+func (v Values) Bool(name string) bool {
+	b, _ := v[name].(bool)
+	return b
+}
+
+// Int returns the named integer value
+func (v Values) Int(name string) int {
+	i, _ := v[name].(int)
+	return i
+}
+
+// Duration returns the named duration value
+func (v Values) Duration(name string) time.Duration {
+	d, _ := v[name].(time.Duration)
+	return d
+}
+
+// IP returns the named IP address value
+func (v Values) IP(name string) net.IP {
+	ip, _ := v[name].(net.IP)
+	return ip
+}
+
+// Flag declares a flag accepted by a command
+//
+// Name is the long name of the flag, given on the command line as --name.
+// Short is an optional single character name, given as -s.  A flag's value
+// follows it either as the next argument or after an equals sign, as in
+// --name=value.  Default is the value used when the flag is not given and is
+// parsed according to the flag's Type.  A Required flag must always be given.
+// If Enum is set then the value must be one of the listed strings.  Usage is
+// a short description of the flag
+type Flag struct {
+	Name     string
+	Short    rune
+	Type     ValueType
+	Default  string
+	Required bool
+	Enum     []string
+	Usage    string
+}
+
+// FlagCommand is the interface for commands that declare their flags
+//
+// The flags are parsed from the arguments before the command is executed.
+// The parsed values are given to the command in inv.Flags and inv.Args holds
+// the arguments that remain.  An argument of -- ends the flags and every
+// argument after it is left in inv.Args
+type FlagCommand interface {
+	Flags() []Flag
+}
+
+// commandFlags returns the flags declared by command
+func commandFlags(command Command) []Flag {
+	if fc, ok := command.(FlagCommand); ok {
+		return fc.Flags()
+	}
+	return nil
+}
+
+// parseValue converts the value given for the flag
+func (flag *Flag) parseValue(name, value string) (interface{}, error) {
+	if len(flag.Enum) > 0 {
+		for _, allowed := range flag.Enum {
+			if value == allowed {
+				return value, nil
+			}
+		}
+		return nil, &FlagError{Name: name, Value: value, Err: ErrInvalidFlagValue, Expected: "one of " + strings.Join(flag.Enum, ", ")}
+	}
+
+	v, err := flag.Type.parse(value)
+	if err != nil {
+		return nil, &FlagError{Name: name, Value: value, Err: ErrInvalidFlagValue, Expected: flag.Type.String()}
+	}
+	return v, nil
+}
+
+// lookupFlag finds the flag named by an argument such as --name or -n
+func lookupFlag(flags []Flag, name string) *Flag {
+	for i := range flags {
+		if name == "--"+flags[i].Name || (flags[i].Short != 0 && name == "-"+string(flags[i].Short)) {
+			return &flags[i]
+		}
+	}
+	return nil
+}
+
+// isFlag reports whether arg should be parsed as a flag.  A lone dash and
+// negative numbers are ordinary arguments unless a flag has that name
+func isFlag(flags []Flag, arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+
+	name := arg
+	if i := strings.Index(arg, "="); i > 0 {
+		name = arg[:i]
+	}
+
+	if _, err := strconv.ParseFloat(arg, 64); err == nil {
+		return lookupFlag(flags, name) != nil
+	}
+	return true
+}
+
+// parseFlags separates the flags from the remaining arguments and converts
+// their values.  Every flag that is not given receives its default value
+func parseFlags(flags []Flag, args []string) (Values, []string, error) {
+	values := Values{}
+	remaining := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			remaining = append(remaining, args[i+1:]...)
+			break
+		}
+
+		if !isFlag(flags, arg) {
+			remaining = append(remaining, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		flag := lookupFlag(flags, name)
+		if flag == nil {
+			return nil, nil, &FlagError{Name: name, Err: ErrUnknownFlag}
+		}
+
+		if !hasValue {
+			if flag.Type == BoolValue {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return nil, nil, &FlagError{Name: name, Err: ErrMissingFlagValue}
+			}
+		}
+
+		v, err := flag.parseValue(name, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[flag.Name] = v
+	}
+
+	for _, flag := range flags {
+		if _, found := values[flag.Name]; found {
+			continue
+		}
+
+		if flag.Required {
+			return nil, nil, &FlagError{Name: "--" + flag.Name, Err: ErrRequiredFlag}
+		}
+
+		if flag.Default == "" {
+			values[flag.Name] = flag.Type.zero()
+			continue
+		}
+
+		v, err := flag.parseValue("--"+flag.Name, flag.Default)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[flag.Name] = v
+	}
+	return values, remaining, nil
+}
+
+// zero returns the zero value of the type
+func (vt ValueType) zero() interface{} {
+	switch vt {
+	case BoolValue:
+		return false
+	case IntValue:
+		return 0
+	case DurationValue:
+		return time.Duration(0)
+	}
+	return ""
+}
+
+// flagSyntax returns how a flag is written on the command line, such as
+// "-c, --count int"
+func flagSyntax(flag Flag) string {
+	syntax := "    --" + flag.Name
+	if flag.Short != 0 {
+		syntax = "-" + string(flag.Short) + ", --" + flag.Name
+	}
+
+	if len(flag.Enum) > 0 {
+		syntax += " " + strings.Join(flag.Enum, "|")
+	} else if flag.Type != BoolValue {
+		syntax += " " + flag.Type.String()
+	}
+	return syntax
+}
+
+// writeFlags lists the flags along with their usage, defaults and whether
+// they are required
+func writeFlags(writer io.Writer, flags []Flag) {
+	width := 0
+	for _, flag := range flags {
+		if len(flagSyntax(flag)) > width {
+			width = len(flagSyntax(flag))
+		}
+	}
+
+	fmt.Fprintf(writer, "\nFlags:\n")
+	for _, flag := range flags {
+		usage := flag.Usage
+		if flag.Required {
+			usage += " (required)"
+		} else if flag.Default != "" {
+			usage += fmt.Sprintf(" (default %s)", flag.Default)
+		}
+		line := fmt.Sprintf("  %-*s  %s", width, flagSyntax(flag), strings.TrimSpace(usage))
+		fmt.Fprintf(writer, "%s\n", strings.TrimRight(line, " "))
+	}
+}
+
+// flagCandidates returns the completion candidates for the word when it is a
+// flag name or the value of a flag.  previous is the argument before the word
+func flagCandidates(flags []Flag, previous, word string) ([]Candidate, bool) {
+	/* the value of a flag, either as the argument
+	 * following the flag or after an equals sign
+	 */
+	prefix := ""
+	flag := lookupFlag(flags, previous)
+	if flag != nil && flag.Type == BoolValue {
+		flag = nil
+	}
+
+	if name, value, found := strings.Cut(word, "="); found && strings.HasPrefix(word, "-") {
+		flag = lookupFlag(flags, name)
+		prefix = name + "="
+		word = value
+	}
+
+	if flag != nil {
+		var candidates []Candidate
+		for _, value := range flag.Enum {
+			if strings.HasPrefix(value, word) {
+				candidates = append(candidates, Candidate{Value: prefix + value})
+			}
+		}
+		return candidates, true
+	}
+
+	if !strings.HasPrefix(word, "-") {
+		return nil, false
+	}
+
+	var candidates []Candidate
+	for _, flag := range flags {
+		if name := "--" + flag.Name; strings.HasPrefix(name, word) {
+			candidates = append(candidates, Candidate{Value: name, Description: flag.Usage, Group: "flags"})
+		}
+	}
+	return candidates, true
+}
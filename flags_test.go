@@ -0,0 +1,178 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+// flagTestCommand is a test command that declares flags
+type flagTestCommand struct {
+	describedCommand
+	flags []Flag
+}
+
+func (f *flagTestCommand) Flags() []Flag {
+	return f.flags
+}
+
+var pingFlags = []Flag{
+	{Name: "count", Short: 'c', Type: IntValue, Default: "5", Usage: "Number of requests"},
+	{Name: "interval", Type: DurationValue, Default: "1s", Usage: "Time between requests"},
+	{Name: "protocol", Short: 'p', Enum: []string{"icmp", "tcp", "udp"}, Required: true, Usage: "Protocol to use"},
+	{Name: "verbose", Short: 'v', Type: BoolValue},
+}
+
+var _ = Describe("Flags", func() {
+	Describe("parsing", func() {
+		It("Should parse long and short flags wherever they appear", func() {
+			values, args, err := parseFlags(pingFlags, []string{"-c", "3", "host", "--protocol=tcp", "-v", "--interval", "2m"})
+			Expect(err).To(BeNil())
+			Expect(args).To(Equal([]string{"host"}))
+			Expect(values.Int("count")).To(Equal(3))
+			Expect(values.String("protocol")).To(Equal("tcp"))
+			Expect(values.Bool("verbose")).To(BeTrue())
+			Expect(values.Duration("interval")).To(Equal(2 * time.Minute))
+		})
+
+		It("Should use the defaults for flags that are not given", func() {
+			values, _, err := parseFlags(pingFlags, []string{"-p", "icmp"})
+			Expect(err).To(BeNil())
+			Expect(values).To(Equal(Values{"count": 5, "interval": time.Second, "protocol": "icmp", "verbose": false}))
+		})
+
+		It("Should leave everything after -- and negative numbers as arguments", func() {
+			_, args, err := parseFlags(pingFlags, []string{"-p", "udp", "-1", "-", "--", "-c", "--bogus"})
+			Expect(err).To(BeNil())
+			Expect(args).To(Equal([]string{"-1", "-", "-c", "--bogus"}))
+		})
+
+		It("Should accept an explicit boolean value", func() {
+			values, _, err := parseFlags(pingFlags, []string{"-p", "udp", "--verbose=false"})
+			Expect(err).To(BeNil())
+			Expect(values.Bool("verbose")).To(BeFalse())
+		})
+
+		It("Should reject unknown flags", func() {
+			_, _, err := parseFlags(pingFlags, []string{"--bogus"})
+			Expect(err).To(Equal(&FlagError{Name: "--bogus", Err: ErrUnknownFlag}))
+			Expect(err).To(MatchError("unknown flag: --bogus"))
+		})
+
+		It("Should require a value for non-boolean flags", func() {
+			_, _, err := parseFlags(pingFlags, []string{"-p", "udp", "--count"})
+			Expect(err).To(MatchError("flag requires a value: --count"))
+			Expect(errors.Is(err, ErrMissingFlagValue)).To(BeTrue())
+		})
+
+		It("Should reject values of the wrong type", func() {
+			_, _, err := parseFlags(pingFlags, []string{"-c", "many"})
+			Expect(err).To(MatchError(`invalid flag value "many" for -c: expected int`))
+		})
+
+		It("Should reject values that are not in the enum", func() {
+			_, _, err := parseFlags(pingFlags, []string{"--protocol", "sctp"})
+			Expect(err).To(MatchError(`invalid flag value "sctp" for --protocol: expected one of icmp, tcp, udp`))
+		})
+
+		It("Should require required flags", func() {
+			_, _, err := parseFlags(pingFlags, []string{"host"})
+			Expect(err).To(MatchError("required flag not given: --protocol"))
+		})
+	})
+
+	Describe("Values", func() {
+		It("Should return zero values for missing names and other types", func() {
+			values := Values{"count": 3}
+			Expect(values.String("count")).To(Equal(""))
+			Expect(values.Int("missing")).To(Equal(0))
+			Expect(Values(nil).Bool("verbose")).To(BeFalse())
+		})
+	})
+
+	Describe("commands", func() {
+		var command *flagTestCommand
+		var shell *Shell
+		var stdout, stderr bytes.Buffer
+
+		BeforeEach(func() {
+			command = &flagTestCommand{flags: pingFlags}
+			command.description = Description{Summary: "Send echo requests", Usage: "<host>"}
+			shell = NewShell(CommandMap{"ping": command})
+			stdout.Reset()
+			stderr.Reset()
+			shell.SetOutputWriter(&stdout)
+			shell.SetErrorWriter(&stderr)
+		})
+
+		It("Should parse the flags before executing the command", func() {
+			Expect(shell.commandMap().Exec(context.Background(), &Invocation{Args: []string{"ping", "-p", "tcp", "host"}})).To(Succeed())
+			Expect(command.arguments).To(Equal([]string{"host"}))
+			Expect(command.invocation.Flags.String("protocol")).To(Equal("tcp"))
+		})
+
+		It("Should not execute the command when the flags are invalid", func() {
+			err := shell.commandMap().Exec(context.Background(), &Invocation{Args: []string{"ping", "--bogus"}})
+			Expect(err).To(MatchError("ping: unknown flag: --bogus"))
+			Expect(command.executed).To(BeFalse())
+		})
+
+		It("Should list the flags in the help", func() {
+			Expect(shell.Run([]string{"help", "ping"})).To(Equal(ExitSuccess))
+			Expect(stdout.String()).To(Equal(`usage: ping [flags] <host>
+
+Send echo requests
+
+Flags:
+  -c, --count int              Number of requests (default 5)
+      --interval duration      Time between requests (default 1s)
+  -p, --protocol icmp|tcp|udp  Protocol to use (required)
+  -v, --verbose
+`))
+		})
+
+		It("Should print the usage when one-shot flags are invalid", func() {
+			Expect(shell.Run([]string{"ping", "-c", "x", "host"})).To(Equal(ExitUsage))
+			Expect(stderr.String()).To(HavePrefix("ping: invalid flag value \"x\" for -c: expected int\n\nusage: ping [flags] <host>\n"))
+		})
+
+		It("Should complete flag names", func() {
+			_, completions, _ := shell.completer.complete("ping host --", 12)
+			Expect(completions).To(Equal([]string{"--count", "--interval", "--protocol", "--verbose"}))
+		})
+
+		It("Should complete enum values", func() {
+			_, completions, _ := shell.completer.complete("ping -p ", 8)
+			Expect(completions).To(Equal([]string{"icmp", "tcp", "udp"}))
+
+			head, completions, _ := shell.completer.complete("ping --protocol=u", 17)
+			Expect(head).To(Equal("ping "))
+			Expect(completions).To(Equal([]string{"--protocol=udp"}))
+		})
+
+		It("Should not complete flag values after boolean flags", func() {
+			command.setCompletions([]string{"core"})
+			_, completions, _ := shell.completer.complete("ping -v ", 8)
+			Expect(completions).To(Equal([]string{"core"}))
+		})
+	})
+})
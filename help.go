@@ -0,0 +1,183 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Description documents a Command
+//
+// Summary is a single line describing the command and is displayed next to
+// the command's name when commands are listed.  Help is a longer explanation
+// of the command.  Usage describes the arguments that follow the command
+// path, such as "<interface> [detail]".  Examples are complete command lines
+// showing how the command is used
+type Description struct {
+	Summary  string
+	Help     string
+	Usage    string
+	Examples []string
+}
+
+// Describer is the interface for commands that describe themselves
+//
+// The description is used by the help builtin and by the --help argument of
+// Shell.Run.  When Usage is empty, the usage of a ParamCommand is taken from
+// its parameters and any other command takes no arguments
+type Describer interface {
+	Describe() Description
+}
+
+// describe returns the description of command, or an empty Description if
+// the command does not implement Describer
+func describe(command Command) Description {
+	if describer, ok := command.(Describer); ok {
+		return describer.Describe()
+	}
+	return Description{}
+}
+
+// commandUsage describes the arguments of command.  The Usage of a
+// Describer takes precedence over the parameters of a ParamCommand
+func commandUsage(command Command) string {
+	if usage := describe(command).Usage; usage != "" {
+		return usage
+	}
+	return paramUsage(commandParams(command))
+}
+
+// describedFunc is a CommandFunc with a description
+type describedFunc struct {
+	CommandFunc
+	description Description
+}
+
+func (d describedFunc) Describe() Description {
+	return d.description
+}
+
+// helpCommand writes the help for the command path given as its arguments
+func helpCommand(ctx context.Context, inv *Invocation) error {
+	if inv.Shell == nil {
+		return ErrNoShell
+	}
+	return inv.Shell.writeHelp(inv.Stdout, inv.Shell.commandMap(), inv.Args)
+}
+
+// writeHelp writes the help for the command with the given path
+//
+// An empty path lists the top level commands.  A path naming a TreeCommand
+// lists its sub-commands and a path naming any other command writes the
+// command's usage, help, flags and examples
+func (shell *Shell) writeHelp(writer io.Writer, commands CommandMap, path []string) error {
+	if len(path) > 0 {
+		var command Command
+		var err error
+		path, command, _, err = commands.find(path, newFindOptions(shell.findOptions()))
+		if err != nil {
+			return err
+		}
+
+		description := describe(command)
+		tree, ok := command.(TreeCommand)
+		if !ok || len(tree.SubCommands()) == 0 {
+			/* commands that do not describe their usage
+			 * may accept any arguments
+			 */
+			usage := strings.Join(path, " ")
+			flags := commandFlags(command)
+			if len(flags) > 0 {
+				usage += " [flags]"
+			}
+
+			if arguments := commandUsage(command); arguments != "" {
+				usage += " " + arguments
+			} else if _, ok := command.(Describer); !ok {
+				usage += " [arguments]"
+			}
+			fmt.Fprintf(writer, "usage: %s\n", usage)
+			writeDescription(writer, description, flags)
+			return nil
+		}
+
+		fmt.Fprintf(writer, "usage: %s <command> [arguments]\n", strings.Join(path, " "))
+		writeDescription(writer, description, nil)
+		fmt.Fprintf(writer, "\n")
+		commands = tree.SubCommands()
+	}
+
+	writeCommandList(writer, shell.permittedCommands(path, commands))
+	return nil
+}
+
+// permittedCommands returns the commands below path that the Shell's
+// privileges allow
+func (shell *Shell) permittedCommands(path []string, commands CommandMap) CommandMap {
+	permitted := make(CommandMap)
+	for name, command := range commands {
+		if shell.authorize(append(path[:len(path):len(path)], name), command) == nil {
+			permitted[name] = command
+		}
+	}
+	return permitted
+}
+
+// writeDescription writes the summary, help, flags and examples of a
+// command.  Each part that is set is preceded by a blank line
+func writeDescription(writer io.Writer, description Description, flags []Flag) {
+	for _, text := range []string{description.Summary, description.Help} {
+		if text != "" {
+			fmt.Fprintf(writer, "\n%s\n", strings.TrimRight(text, "\n"))
+		}
+	}
+
+	if len(flags) > 0 {
+		writeFlags(writer, flags)
+	}
+
+	if len(description.Examples) > 0 {
+		fmt.Fprintf(writer, "\nExamples:\n")
+		for _, example := range description.Examples {
+			fmt.Fprintf(writer, "  %s\n", example)
+		}
+	}
+}
+
+// writeCommandList writes the sorted names of the commands along with their
+// summaries.  The summaries are aligned in a single column
+func writeCommandList(writer io.Writer, commands CommandMap) {
+	names := make([]string, 0, len(commands))
+	width := 0
+	for name := range commands {
+		names = append(names, name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(writer, "Available commands:\n")
+	for _, name := range names {
+		line := fmt.Sprintf("  %-*s  %s", width, name, describe(commands[name]).Summary)
+		fmt.Fprintf(writer, "%s\n", strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,124 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// describedCommand is a test command with a description
+type describedCommand struct {
+	testCommand
+	description Description
+}
+
+func (d *describedCommand) Describe() Description {
+	return d.description
+}
+
+var _ = Describe("help", func() {
+	var shell *Shell
+	var stdout bytes.Buffer
+
+	BeforeEach(func() {
+		shell = NewShell(CommandMap{
+			"show": NewTreeCommand(CommandMap{
+				"interface": &describedCommand{description: Description{
+					Summary:  "Display an interface",
+					Help:     "Displays the addresses of the named interface.\n",
+					Usage:    "<name>",
+					Examples: []string{"show interface eth0", "show interface lo"},
+				}},
+				"interfaces": &describedCommand{description: Description{Summary: "List the interfaces"}},
+				"time":       newTestCommand(),
+			}).WithDescription(Description{Summary: "Display system information"}),
+		})
+		delete(shell.Builtins(), "disable")
+		delete(shell.Builtins(), "enable")
+		delete(shell.Builtins(), "fg")
+		delete(shell.Builtins(), "jobs")
+		delete(shell.Builtins(), "kill")
+		delete(shell.Builtins(), "source")
+		stdout.Reset()
+		shell.SetOutputWriter(&stdout)
+	})
+
+	execLine := func(line string) error {
+		return shell.execLine(context.Background(), shell.invocation(), line)
+	}
+
+	It("Should list the top level commands with their summaries", func() {
+		Expect(execLine("help")).To(Succeed())
+		Expect(stdout.String()).To(Equal("Available commands:\n  help  Display help for commands\n  show  Display system information\n"))
+	})
+
+	It("Should list the sub-commands of a tree", func() {
+		Expect(execLine("help show")).To(Succeed())
+		Expect(stdout.String()).To(Equal(`usage: show <command> [arguments]
+
+Display system information
+
+Available commands:
+  interface   Display an interface
+  interfaces  List the interfaces
+  time
+`))
+	})
+
+	It("Should display the details of a leaf command", func() {
+		Expect(execLine("help show interface")).To(Succeed())
+		Expect(stdout.String()).To(Equal(`usage: show interface <name>
+
+Display an interface
+
+Displays the addresses of the named interface.
+
+Examples:
+  show interface eth0
+  show interface lo
+`))
+	})
+
+	It("Should describe its own usage", func() {
+		Expect(execLine("help help")).To(Succeed())
+		Expect(stdout.String()).To(HavePrefix("usage: help [command]\n\nDisplay help for commands\n"))
+	})
+
+	It("Should allow any arguments for commands that are not described", func() {
+		Expect(execLine("help show time")).To(Succeed())
+		Expect(stdout.String()).To(Equal("usage: show time [arguments]\n"))
+	})
+
+	It("Should omit the arguments of described commands without a usage", func() {
+		shell.commands.Add("reload", &describedCommand{description: Description{Summary: "Reload"}})
+		Expect(execLine("help reload")).To(Succeed())
+		Expect(stdout.String()).To(Equal("usage: reload\n\nReload\n"))
+	})
+
+	It("Should accept abbreviations once enabled", func() {
+		shell.SetAbbreviations(true)
+		Expect(execLine("help sh interfaces")).To(Succeed())
+		Expect(stdout.String()).To(Equal("usage: show interfaces\n\nList the interfaces\n"))
+	})
+
+	It("Should return an error for an unknown command", func() {
+		Expect(execLine("help bogus")).To(MatchError(ErrNoMatchingCommand))
+	})
+})
@@ -0,0 +1,249 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// commandsAdded counts the commands added with CommandMap.Add.  An index is
+// rebuilt when it changes
+var commandsAdded atomic.Uint64
+
+// radixNode is a node in a radix trie of command names.  label is the part
+// of the name on the edge leading to the node and leaf is set when a name
+// ends at the node.  children are ordered by the first byte of their labels
+type radixNode struct {
+	label    string
+	leaf     bool
+	children []*radixNode
+}
+
+// child returns the position of the child whose label begins with b, or the
+// position it would be inserted at
+func (node *radixNode) child(b byte) (int, bool) {
+	i := sort.Search(len(node.children), func(i int) bool {
+		return node.children[i].label[0] >= b
+	})
+	return i, i < len(node.children) && node.children[i].label[0] == b
+}
+
+// insert adds name to the trie rooted at node
+func (node *radixNode) insert(name string) {
+	for name != "" {
+		i, found := node.child(name[0])
+		if !found {
+			node.children = append(node.children, nil)
+			copy(node.children[i+1:], node.children[i:])
+			node.children[i] = &radixNode{label: name, leaf: true}
+			return
+		}
+
+		next := node.children[i]
+		common := commonPrefix(next.label, name)
+		if common < len(next.label) {
+			/* split the edge where the names diverge */
+			next.label = next.label[common:]
+			next = &radixNode{label: name[:common], children: []*radixNode{next}}
+			node.children[i] = next
+		}
+		node, name = next, name[common:]
+	}
+	node.leaf = true
+}
+
+// collect appends every name at or below node to names in sorted order.
+// prefix is the part of the name leading to node
+func (node *radixNode) collect(prefix string, names []string) []string {
+	if node.leaf {
+		names = append(names, prefix)
+	}
+
+	for _, child := range node.children {
+		names = child.collect(prefix+child.label, names)
+	}
+	return names
+}
+
+// withPrefix returns the sorted names in the trie that begin with prefix
+func (node *radixNode) withPrefix(prefix string) []string {
+	path := ""
+	for rest := prefix; rest != ""; {
+		i, found := node.child(rest[0])
+		if !found {
+			return nil
+		}
+
+		node = node.children[i]
+		common := commonPrefix(node.label, rest)
+		if common == len(rest) {
+			/* the prefix ends within this edge */
+			return node.collect(path+node.label, nil)
+		} else if common < len(node.label) {
+			return nil
+		}
+		path += node.label
+		rest = rest[common:]
+	}
+	return node.collect(path, nil)
+}
+
+// commonPrefix returns the length of the prefix shared by a and b
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// commandIndex is a radix trie of the names in one or more CommandMaps.  It
+// provides the names in a deterministic order and finds the names that begin
+// with a prefix without scanning every command.  A name that is in more than
+// one of the maps refers to the command in the first of them
+//
+// The index is rebuilt when a command has been added to any map with Add, or
+// when the number of commands in one of its maps has changed, so commands can
+// be added to and removed from the maps after the index is created.  Checking
+// for changes does not depend on the number of commands
+type commandIndex struct {
+	lock   sync.Mutex
+	maps   []CommandMap
+	added  uint64
+	sizes  []int
+	root   *radixNode
+	sorted []string
+}
+
+func newCommandIndex(maps ...CommandMap) *commandIndex {
+	index := &commandIndex{maps: maps}
+	index.build()
+	return index
+}
+
+// build creates the trie from the names in the maps.  The index must be
+// locked unless it is being created
+func (index *commandIndex) build() {
+	index.added = commandsAdded.Load()
+	index.sizes = index.sizes[:0]
+	index.root = &radixNode{}
+	known := make(map[string]bool)
+	for _, commands := range index.maps {
+		index.sizes = append(index.sizes, len(commands))
+		for name := range commands {
+			if !known[name] {
+				known[name] = true
+				index.root.insert(name)
+			}
+		}
+	}
+	index.sorted = index.root.collect("", make([]string, 0, len(known)))
+}
+
+// update rebuilds the trie if the maps may have changed.  The index must be
+// locked
+func (index *commandIndex) update() {
+	if index.added != commandsAdded.Load() {
+		index.build()
+		return
+	}
+
+	for i, commands := range index.maps {
+		if len(commands) != index.sizes[i] {
+			index.build()
+			return
+		}
+	}
+}
+
+// command returns the command called name in the first map that has it
+func (index *commandIndex) command(name string) Command {
+	for _, commands := range index.maps {
+		if command, found := commands[name]; found {
+			return command
+		}
+	}
+	return nil
+}
+
+// indexes reports whether the first map of the index is commands
+func (index *commandIndex) indexes(commands CommandMap) bool {
+	return index != nil && len(index.maps) > 0 && sameMap(index.maps[0], commands)
+}
+
+// withPrefix returns the sorted names that begin with prefix
+func (index *commandIndex) withPrefix(prefix string) []string {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	index.update()
+	return index.root.withPrefix(prefix)
+}
+
+// names returns every name in sorted order
+func (index *commandIndex) names() []string {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	index.update()
+	return index.sorted
+}
+
+// sameMap reports whether a and b are the same map
+func sameMap(a, b CommandMap) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// commandNamed returns the command called name in commands or, if index is
+// not nil, in the maps of the index
+func commandNamed(commands CommandMap, index *commandIndex, name string) Command {
+	if index != nil {
+		return index.command(name)
+	}
+	return commands[name]
+}
+
+// matchingNames returns the sorted names in commands that word matches.  A
+// nil matcher is PrefixMatch.  The index is used when it is not nil,
+// otherwise the map is scanned
+func matchingNames(commands CommandMap, index *commandIndex, word string, matcher Matcher) []string {
+	var names []string
+	if index == nil {
+		names = make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else if matcher == nil {
+		return index.withPrefix(word)
+	} else {
+		names = index.names()
+	}
+
+	if matcher == nil {
+		matcher = PrefixMatch
+	}
+
+	matches := names[:0:0]
+	for _, name := range names {
+		if _, ok := matcher(word, name); ok {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
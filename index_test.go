@@ -0,0 +1,236 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var _ = Describe("commandIndex", func() {
+	It("Should return names with a prefix in sorted order", func() {
+		commands := CommandMap{}
+		for _, name := range []string{"interfaces", "in", "interface", "ip", "i", "inter", "show", "shutdown"} {
+			commands[name] = newTestCommand()
+		}
+		index := newCommandIndex(commands)
+
+		Expect(index.names()).To(Equal([]string{"i", "in", "inter", "interface", "interfaces", "ip", "show", "shutdown"}))
+		Expect(index.withPrefix("int")).To(Equal([]string{"inter", "interface", "interfaces"}))
+		Expect(index.withPrefix("interface")).To(Equal([]string{"interface", "interfaces"}))
+		Expect(index.withPrefix("sh")).To(Equal([]string{"show", "shutdown"}))
+		Expect(index.withPrefix("shx")).To(BeEmpty())
+		Expect(index.withPrefix("x")).To(BeEmpty())
+	})
+
+	It("Should match a scan of the names", func() {
+		random := rand.New(rand.NewSource(1))
+		commands := CommandMap{}
+		for i := 0; i < 2000; i++ {
+			name := make([]byte, 1+random.Intn(6))
+			for j := range name {
+				name[j] = "abc"[random.Intn(3)]
+			}
+			commands[string(name)] = newTestCommand()
+		}
+		index := newCommandIndex(commands)
+
+		for _, prefix := range []string{"", "a", "ab", "abc", "cab", "bbbb", "acbac", "ccccccc"} {
+			expected := []string{}
+			for name := range commands {
+				if strings.HasPrefix(name, prefix) {
+					expected = append(expected, name)
+				}
+			}
+			sort.Strings(expected)
+			Expect(append([]string{}, index.withPrefix(prefix)...)).To(Equal(expected), prefix)
+		}
+	})
+
+	It("Should follow changes to the map", func() {
+		tree := NewTreeCommand(CommandMap{"interface": newTestCommand()})
+		Expect(tree.Add("interfaces", newTestCommand())).To(Succeed())
+		Expect(tree.index.withPrefix("inter")).To(Equal([]string{"interface", "interfaces"}))
+
+		delete(tree.SubCommands(), "interface")
+		Expect(tree.index.withPrefix("inter")).To(Equal([]string{"interfaces"}))
+	})
+
+	It("Should follow a name that replaces another", func() {
+		tree := NewTreeCommand(CommandMap{"interface": newTestCommand(), "ip": newTestCommand()})
+		Expect(tree.index.withPrefix("i")).To(Equal([]string{"interface", "ip"}))
+
+		delete(tree.SubCommands(), "ip")
+		Expect(tree.Add("ipv6", newTestCommand())).To(Succeed())
+		Expect(tree.index.withPrefix("i")).To(Equal([]string{"interface", "ipv6"}))
+
+		command, _, err := CommandMap{"show": tree}.Find([]string{"show", "ipv"}, AllowAbbreviations())
+		Expect(err).To(BeNil())
+		Expect(command).To(BeIdenticalTo(tree.SubCommands()["ipv6"]))
+	})
+
+	It("Should index the names of several maps", func() {
+		commands := CommandMap{"show": newTestCommand()}
+		builtins := CommandMap{"show": newTestCommand(), "shutdown": newTestCommand()}
+		index := newCommandIndex(commands, builtins)
+		Expect(index.withPrefix("sh")).To(Equal([]string{"show", "shutdown"}))
+		Expect(index.command("show")).To(BeIdenticalTo(commands["show"]))
+
+		delete(builtins, "shutdown")
+		Expect(builtins.Add("history", newTestCommand())).To(Succeed())
+		Expect(index.names()).To(Equal([]string{"history", "show"}))
+	})
+
+	It("Should only rebuild the trie when the maps change", func() {
+		commands := CommandMap{"show": newTestCommand()}
+		index := newCommandIndex(commands)
+		root := index.root
+		Expect(index.withPrefix("sh")).To(Equal([]string{"show"}))
+		Expect(index.names()).To(Equal([]string{"show"}))
+		Expect(index.root).To(BeIdenticalTo(root))
+
+		Expect(commands.Add("shutdown", newTestCommand())).To(Succeed())
+		Expect(index.withPrefix("sh")).To(Equal([]string{"show", "shutdown"}))
+		Expect(index.root).NotTo(BeIdenticalTo(root))
+	})
+
+	It("Should find commands whose names are prefixes of other names", func() {
+		command := newTestCommand()
+		commands := CommandMap{
+			"show": NewTreeCommand(CommandMap{
+				"interface":  command,
+				"interfaces": newTestCommand(),
+			}),
+		}
+
+		for i := 0; i < 10; i++ {
+			found, _, err := commands.Find([]string{"show", "interface"}, AllowAbbreviations())
+			Expect(err).To(BeNil())
+			Expect(found).To(BeIdenticalTo(command))
+		}
+	})
+})
+
+// largeTree returns a tree of about 50,000 commands, with 50 modules of 1,000
+// ports each
+func largeTree() CommandMap {
+	modules := CommandMap{}
+	for i := 0; i < 50; i++ {
+		ports := CommandMap{}
+		for j := 0; j < 1000; j++ {
+			ports[fmt.Sprintf("port-%04d", j)] = newTestCommand()
+		}
+		modules[fmt.Sprintf("module-%02d", i)] = NewTreeCommand(ports)
+	}
+	return CommandMap{"show": NewTreeCommand(modules)}
+}
+
+// wideTopLevel returns 50,000 top level commands
+func wideTopLevel() CommandMap {
+	commands := CommandMap{}
+	for i := 0; i < 50000; i++ {
+		commands[fmt.Sprintf("command-%05d", i)] = newTestCommand()
+	}
+	return commands
+}
+
+// benchmarkTarget is the longest that completing or executing a command may
+// take on average in the benchmarks of large command sets
+const benchmarkTarget = time.Millisecond
+
+// checkTarget fails the benchmark if its operations took longer than
+// benchmarkTarget on average.  The benchmarks run their operation once before
+// resetting the timer so that building the indexes is not measured
+func checkTarget(b *testing.B) {
+	if perOp := b.Elapsed() / time.Duration(b.N); perOp > benchmarkTarget {
+		b.Fatalf("%v per operation exceeds the target of %v", perOp, benchmarkTarget)
+	}
+}
+
+func BenchmarkCompleteWideTopLevel(b *testing.B) {
+	c := newCompleter(wideTopLevel())
+	c.builtins = newBuiltins()
+	line := "command-0250"
+	c.complete(line, len(line))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, completions, _ := c.complete(line, len(line)); len(completions) != 10 {
+			b.Fatalf("expected 10 completions, got %d", len(completions))
+		}
+	}
+	checkTarget(b)
+}
+
+func BenchmarkExecWideTopLevel(b *testing.B) {
+	shell := NewShell(wideTopLevel())
+	shell.SetOutputWriter(io.Discard)
+	shell.Run([]string{"command-25000"})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if status := shell.Run([]string{"command-25000"}); status != ExitSuccess {
+			b.Fatalf("expected success, got %d", status)
+		}
+	}
+	checkTarget(b)
+}
+
+func BenchmarkCompleteLargeTree(b *testing.B) {
+	c := newCompleter(largeTree())
+	line := "show module-25 port-07"
+	c.complete(line, len(line))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, completions, _ := c.complete(line, len(line)); len(completions) != 100 {
+			b.Fatalf("expected 100 completions, got %d", len(completions))
+		}
+	}
+	checkTarget(b)
+}
+
+func BenchmarkCompleteLargeTreeAbbreviated(b *testing.B) {
+	c := newCompleter(largeTree())
+	c.options = []FindOption{AllowAbbreviations()}
+	line := "sh module-02 port-0999"
+	c.complete(line, len(line))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, completions, _ := c.complete(line, len(line)); len(completions) != 1 {
+			b.Fatalf("expected 1 completion, got %d", len(completions))
+		}
+	}
+	checkTarget(b)
+}
+
+func BenchmarkFindLargeTree(b *testing.B) {
+	commands := largeTree()
+	args := []string{"sh", "module-04", "port-0999"}
+	commands.Find(args, AllowAbbreviations())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := commands.Find(args, AllowAbbreviations()); err != nil {
+			b.Fatal(err)
+		}
+	}
+	checkTarget(b)
+}
@@ -0,0 +1,120 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// DefaultGracePeriod is how long a Shell waits for an interrupted command to
+// return before abandoning it
+const DefaultGracePeriod = 2 * time.Second
+
+func notifyInterrupt(interrupts chan<- os.Signal) {
+	signal.Notify(interrupts, os.Interrupt)
+}
+
+func stopInterrupt(interrupts chan<- os.Signal) {
+	signal.Stop(interrupts)
+}
+
+// SetGracePeriod sets how long the Shell waits for a command to return once
+// it has been interrupted
+//
+// When an interrupt (SIGINT) is received while a command is executing, the
+// context given to the command is cancelled.  If the command has not returned
+// by the end of the grace period, or a second interrupt is received, then the
+// Shell abandons the command and returns ErrCommandAbandoned.  A command
+// whose timeout expires is given the same grace period.  The grace period
+// defaults to DefaultGracePeriod
+func (shell *Shell) SetGracePeriod(gracePeriod time.Duration) {
+	shell.gracePeriod = gracePeriod
+}
+
+// abandonAfter returns how long a command that has been cancelled is waited
+// for.  shell may be nil
+func (shell *Shell) abandonAfter() time.Duration {
+	if shell == nil {
+		return DefaultGracePeriod
+	}
+	return shell.gracePeriod
+}
+
+// SetInterrupts makes the Shell receive interrupts from a channel rather
+// than from the process
+//
+// Each value received from interrupts is handled just like an interrupt
+// (SIGINT) would be, and the process's own interrupts are then left alone.
+// This allows a program to serve several Shells, such as one per remote
+// session, where each session requests its own interrupts
+func (shell *Shell) SetInterrupts(interrupts <-chan os.Signal) {
+	shell.interrupts = interrupts
+}
+
+// catchInterrupts starts delivering interrupt signals to a channel rather
+// than letting them terminate the process.  The returned function stops the
+// delivery
+func (shell *Shell) catchInterrupts() (<-chan os.Signal, func()) {
+	if shell.interrupts != nil {
+		return shell.interrupts, func() {}
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	shell.notifyInterrupt(interrupts)
+	return interrupts, func() { shell.stopInterrupt(interrupts) }
+}
+
+// execInterruptible calls exec with a context that is cancelled when an
+// interrupt is received or the Shell is closed.  Interrupts that arrived
+// before exec was called are discarded.  If exec is interrupted then
+// ErrInterrupted is returned, or ErrCommandAbandoned if it does not return
+// within the grace period
+func (shell *Shell) execInterruptible(interrupts <-chan os.Signal, exec func(context.Context) error) error {
+	for len(interrupts) > 0 {
+		<-interrupts
+	}
+
+	ctx, cancel := context.WithCancel(shell.ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- exec(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-interrupts:
+		cancel()
+	case <-ctx.Done():
+	}
+
+	timer := time.NewTimer(shell.gracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return ErrInterrupted
+	case <-timer.C:
+	case <-interrupts:
+	}
+	return ErrCommandAbandoned
+}
@@ -0,0 +1,119 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"os"
+	"time"
+)
+
+// interruptingCommand sends an interrupt to the shell once it is executing
+// and then waits for its context to be cancelled, unless it is stubborn
+func interruptingCommand(interrupts *chan<- os.Signal, stubborn bool) Command {
+	return CommandFunc(func(ctx context.Context, inv *Invocation) error {
+		*interrupts <- os.Interrupt
+		if stubborn {
+			time.Sleep(time.Second)
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+}
+
+var _ = Describe("Interrupts", func() {
+	var shell *Shell
+	var commands CommandMap
+	var interrupts chan<- os.Signal
+	var stopped bool
+	var stderr bytes.Buffer
+
+	BeforeEach(func() {
+		commands = CommandMap{}
+		shell = NewShell(commands)
+		stopped = false
+		stderr.Reset()
+		shell.SetErrorWriter(&stderr)
+		shell.SetOutputWriter(&bytes.Buffer{})
+		shell.notifyInterrupt = func(c chan<- os.Signal) { interrupts = c }
+		shell.stopInterrupt = func(c chan<- os.Signal) { stopped = true }
+		commands.Add("wait", interruptingCommand(&interrupts, false))
+		commands.Add("stubborn", interruptingCommand(&interrupts, true))
+	})
+
+	Describe("Exec", func() {
+		var prompt *testPrompt
+		var command *testCommand
+
+		BeforeEach(func() {
+			prompt = newTestPrompt()
+			shell.SetPrompt(prompt)
+			command = newTestCommand()
+			commands.Add("test", command)
+		})
+
+		It("Should cancel the command and return to the prompt", func() {
+			prompt.lineEditor.addResponse("wait", nil)
+			prompt.lineEditor.addResponse("test", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(stderr.String()).To(Equal(ErrInterrupted.Error() + "\n"))
+			Expect(command.executed).To(BeTrue())
+			Expect(stopped).To(BeTrue())
+		})
+
+		It("Should abandon commands that outlast the grace period", func() {
+			shell.SetGracePeriod(10 * time.Millisecond)
+			prompt.lineEditor.addResponse("stubborn", nil)
+			prompt.lineEditor.addResponse("test", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(stderr.String()).To(Equal(ErrCommandAbandoned.Error() + "\n"))
+			Expect(command.executed).To(BeTrue())
+		})
+
+		It("Should silently discard the line when the prompt is interrupted", func() {
+			prompt.lineEditor.addResponse("", ErrInterrupted)
+			prompt.lineEditor.addResponse("test", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(stderr.String()).To(BeEmpty())
+			Expect(command.executed).To(BeTrue())
+		})
+
+		It("Should discard interrupts received before the command started", func() {
+			prompt.lineEditor.addResponse("test", nil)
+			prompt.lineEditor.end()
+			shell.notifyInterrupt = func(c chan<- os.Signal) { c <- os.Interrupt }
+			shell.Exec()
+			Expect(stderr.String()).To(BeEmpty())
+			Expect(command.executed).To(BeTrue())
+		})
+	})
+
+	Describe("Run", func() {
+		It("Should exit with ExitInterrupted", func() {
+			Expect(shell.Run([]string{"wait"})).To(Equal(ExitInterrupted))
+			Expect(stderr.String()).To(Equal(ErrInterrupted.Error() + "\n"))
+			Expect(stopped).To(BeTrue())
+		})
+	})
+})
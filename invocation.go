@@ -0,0 +1,72 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Invocation describes a single execution of a Command
+//
+// Path is the list of command names that were used to find the Command in the
+// CommandMap and Args are the remaining fields that followed the path.  For
+// instance, executing "show interface eth0" results in a Path of
+// []string{"show", "interface"} and Args of []string{"eth0"}.  Shell is the
+// session the command is running in and is nil when a CommandMap is executed
+// outside of a Shell
+//
+// Stdin, Stdout and Stderr are the streams the command should use for input,
+// output and error messages.  Commands should use these rather than os.Stdin,
+// os.Stdout and os.Stderr so that their output can be captured or redirected.
+// Any stream left nil is set to the corresponding os stream when the
+// invocation is executed by a CommandMap
+//
+// Timeout limits how long the command may execute unless the command
+// implements TimeoutCommand.  A zero Timeout means there is no limit
+//
+// Flags holds the values of the flags declared by a FlagCommand.  The flags
+// are removed from Args before the command is executed.  Params holds the
+// converted values of the positional parameters declared by a ParamCommand
+type Invocation struct {
+	Path    []string
+	Args    []string
+	Flags   Values
+	Params  Values
+	Shell   *Shell
+	Timeout time.Duration
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// setDefaultStreams assigns the process streams to any unset stream
+func (inv *Invocation) setDefaultStreams() {
+	if inv.Stdin == nil {
+		inv.Stdin = os.Stdin
+	}
+
+	if inv.Stdout == nil {
+		inv.Stdout = os.Stdout
+	}
+
+	if inv.Stderr == nil {
+		inv.Stderr = os.Stderr
+	}
+}
@@ -0,0 +1,402 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JobState is the state of a background job
+type JobState int
+
+const (
+	// JobRunning indicates the job has not completed
+	JobRunning JobState = iota
+
+	// JobDone indicates the job completed successfully
+	JobDone
+
+	// JobFailed indicates the job completed with an error
+	JobFailed
+
+	// JobKilled indicates the job was stopped by the kill builtin
+	JobKilled
+)
+
+func (state JobState) String() string {
+	switch state {
+	case JobRunning:
+		return "Running"
+	case JobDone:
+		return "Done"
+	case JobFailed:
+		return "Failed"
+	case JobKilled:
+		return "Killed"
+	}
+	return fmt.Sprintf("JobState(%d)", int(state))
+}
+
+// JobOutputSize is the number of bytes of output that a background job keeps
+const JobOutputSize = 64 * 1024
+
+// Job is a command line that is executing in the background
+//
+// What the job writes to its output and error streams is kept in its output
+// buffer so that it does not interfere with the prompt.  Only the last
+// JobOutputSize bytes are kept.  The output is displayed when the job is
+// brought to the foreground with the fg builtin.  A job stays in the Shell's
+// jobs, even after it has completed, until it is brought to the foreground or
+// killed
+type Job struct {
+	id      int
+	command string
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	lock     sync.Mutex
+	state    JobState
+	err      error
+	output   ringBuffer
+	changed  chan struct{}
+	reported bool
+}
+
+// ID returns the number used to refer to the job
+func (job *Job) ID() int {
+	return job.id
+}
+
+// Command returns the command line the job is executing
+func (job *Job) Command() string {
+	return job.command
+}
+
+// State returns the current state of the job
+func (job *Job) State() JobState {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.state
+}
+
+// Err returns the error the job completed with.  It is nil while the job is
+// running
+func (job *Job) Err() error {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.err
+}
+
+// Output returns the output that the job has kept so far
+func (job *Job) Output() string {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	output, _ := job.output.since(0)
+	return string(output)
+}
+
+// Done returns a channel that is closed once the job has completed
+func (job *Job) Done() <-chan struct{} {
+	return job.done
+}
+
+// write appends p to the job's output buffer
+func (job *Job) write(p []byte) (int, error) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.output.Write(p)
+	job.signal()
+	return len(p), nil
+}
+
+// signal wakes up anything following the job.  The lock must be held
+func (job *Job) signal() {
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+func (job *Job) finish(err error) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.err = err
+	if job.state == JobRunning {
+		job.state = JobDone
+		if err != nil {
+			job.state = JobFailed
+		}
+	}
+	close(job.done)
+	job.signal()
+}
+
+// report returns the state of the job and whether it has completed without
+// having been reported before
+func (job *Job) report() (JobState, bool) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	if job.state == JobRunning || job.reported {
+		return job.state, false
+	}
+	job.reported = true
+	return job.state, true
+}
+
+// kill cancels the job's context.  The job is killed unless it has
+// already completed
+func (job *Job) kill() {
+	job.lock.Lock()
+	if job.state == JobRunning {
+		job.state = JobKilled
+	}
+	job.lock.Unlock()
+	job.cancel()
+}
+
+// follow writes the job's output to writer until the job completes and then
+// returns the job's error.  If ctx is cancelled first then the job is killed
+func (job *Job) follow(ctx context.Context, writer io.Writer) error {
+	var offset int64
+	for {
+		job.lock.Lock()
+		output, next := job.output.since(offset)
+		offset = next
+		state := job.state
+		err := job.err
+		changed := job.changed
+		job.lock.Unlock()
+
+		if len(output) > 0 {
+			if _, err := writer.Write(output); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if state != JobRunning {
+			return err
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			job.kill()
+			return ctx.Err()
+		}
+	}
+}
+
+// ringBuffer keeps the last JobOutputSize bytes written to it
+type ringBuffer struct {
+	data    []byte
+	start   int
+	written int64
+}
+
+func (r *ringBuffer) Write(p []byte) {
+	r.written += int64(len(p))
+	if len(p) >= JobOutputSize {
+		r.data = append(r.data[:0], p[len(p)-JobOutputSize:]...)
+		r.start = 0
+		return
+	}
+
+	/* the buffer grows until it is full and then
+	 * overwrites the oldest bytes
+	 */
+	if n := JobOutputSize - len(r.data); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		r.data = append(r.data, p[:n]...)
+		p = p[n:]
+	}
+
+	for len(p) > 0 {
+		n := copy(r.data[r.start:], p)
+		p = p[n:]
+		r.start = (r.start + n) % len(r.data)
+	}
+}
+
+// since returns a copy of the bytes written after offset, which counts every
+// byte ever written, and the offset of the end of the buffer.  Bytes that
+// have already been overwritten are skipped
+func (r *ringBuffer) since(offset int64) ([]byte, int64) {
+	if oldest := r.written - int64(len(r.data)); offset < oldest {
+		offset = oldest
+	}
+
+	output := make([]byte, 0, r.written-offset)
+	output = append(output, r.data[r.start:]...)
+	output = append(output, r.data[:r.start]...)
+	return output[int64(len(output))-(r.written-offset):], r.written
+}
+
+// jobWriter writes to the output buffer of a job
+type jobWriter struct {
+	job *Job
+}
+
+func (w jobWriter) Write(p []byte) (int, error) {
+	return w.job.write(p)
+}
+
+// jobTable is the list of background jobs of a Shell.  Job ids are never
+// reused
+type jobTable struct {
+	lock   sync.Mutex
+	jobs   []*Job
+	lastID int
+}
+
+// start runs exec in the background as a new job.  exec is given a context
+// that is only cancelled when the job is killed and the writer for the job's
+// output
+func (table *jobTable) start(ctx context.Context, command string, exec func(context.Context, io.Writer) error) *Job {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	table.lock.Lock()
+	table.lastID++
+	job := &Job{
+		id:      table.lastID,
+		command: command,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+	table.jobs = append(table.jobs, job)
+	table.lock.Unlock()
+
+	go func() {
+		defer cancel()
+		job.finish(exec(ctx, jobWriter{job}))
+	}()
+	return job
+}
+
+// killAll kills every job that is still running
+func (table *jobTable) killAll() {
+	for _, job := range table.list() {
+		job.kill()
+	}
+}
+
+// list returns the jobs in the order they were started
+func (table *jobTable) list() []*Job {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	return append([]*Job(nil), table.jobs...)
+}
+
+// find returns the job with the given id.  The id may be prefixed with %
+func (table *jobTable) find(id string) (*Job, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(id, "%"))
+	if err == nil {
+		for _, job := range table.list() {
+			if job.id == n {
+				return job, nil
+			}
+		}
+	}
+	return nil, &NoSuchJobError{ID: id}
+}
+
+// remove deletes the job from the table
+func (table *jobTable) remove(job *Job) {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	for i, j := range table.jobs {
+		if j == job {
+			table.jobs = append(table.jobs[:i], table.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// notify writes the status of every job that has completed since the last
+// notification.  The jobs are kept so that their output can still be
+// displayed
+func (table *jobTable) notify(writer io.Writer) {
+	for _, job := range table.list() {
+		if state, ok := job.report(); ok {
+			fmt.Fprintf(writer, "%s\n", formatJob(job, state))
+		}
+	}
+}
+
+func formatJob(job *Job, state JobState) string {
+	return fmt.Sprintf("[%d] %-8s %s", job.id, state, job.command)
+}
+
+// jobsCommand lists the shell's background jobs
+func jobsCommand(ctx context.Context, inv *Invocation) error {
+	if inv.Shell == nil {
+		return ErrNoShell
+	}
+
+	for _, job := range inv.Shell.jobs.list() {
+		fmt.Fprintf(inv.Stdout, "%s\n", formatJob(job, job.State()))
+	}
+	return nil
+}
+
+// jobArgument returns the job named by the single argument of the invocation
+func jobArgument(inv *Invocation) (*Job, error) {
+	if len(inv.Args) != 1 {
+		return nil, ErrMissingJobID
+	}
+
+	if inv.Shell == nil {
+		return nil, ErrNoShell
+	}
+	return inv.Shell.jobs.find(inv.Args[0])
+}
+
+// fgCommand displays the output of a background job and waits for it to
+// complete.  The job is then removed from the job table
+func fgCommand(ctx context.Context, inv *Invocation) error {
+	job, err := jobArgument(inv)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(inv.Stdout, "%s\n", job.command)
+	err = job.follow(ctx, inv.Stdout)
+	inv.Shell.jobs.remove(job)
+	return err
+}
+
+// killCommand stops a background job and removes it from the job table
+func killCommand(ctx context.Context, inv *Invocation) error {
+	job, err := jobArgument(inv)
+	if err != nil {
+		return err
+	}
+
+	job.kill()
+	inv.Shell.jobs.remove(job)
+	select {
+	case <-job.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,226 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io"
+)
+
+// blockingCommand writes its arguments and then waits until it is released
+// or its context is cancelled
+func blockingCommand(release chan struct{}) Command {
+	return CommandFunc(func(ctx context.Context, inv *Invocation) error {
+		fmt.Fprintln(inv.Stdout, inv.Args)
+		select {
+		case <-release:
+			fmt.Fprintln(inv.Stdout, "released")
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+var _ = Describe("Jobs", func() {
+	var shell *Shell
+	var release chan struct{}
+	var stdout, stderr bytes.Buffer
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		shell = NewShell(CommandMap{
+			"block": blockingCommand(release),
+			"echo":  CommandFunc(echoCommand),
+			"fail": CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				return errors.New("failed")
+			}),
+		})
+		stdout.Reset()
+		stderr.Reset()
+		shell.SetOutputWriter(&stdout)
+		shell.SetErrorWriter(&stderr)
+	})
+
+	execLine := func(line string) error {
+		return shell.execLine(context.Background(), shell.invocation(), line)
+	}
+
+	It("Should run a command line ending in & in the background", func() {
+		Expect(execLine("block one && echo two &")).To(Succeed())
+		Expect(stdout.String()).To(Equal("[1] block one && echo two\n"))
+
+		jobs := shell.jobs.list()
+		Expect(jobs).To(HaveLen(1))
+		Expect(jobs[0].ID()).To(Equal(1))
+		Expect(jobs[0].Command()).To(Equal("block one && echo two"))
+		Expect(jobs[0].State()).To(Equal(JobRunning))
+		Eventually(jobs[0].Output).Should(Equal("[one]\n"))
+
+		close(release)
+		Eventually(jobs[0].Done()).Should(BeClosed())
+		Expect(jobs[0].State()).To(Equal(JobDone))
+		Expect(jobs[0].Output()).To(Equal("[one]\nreleased\ntwo\n"))
+	})
+
+	It("Should list the jobs", func() {
+		Expect(execLine("block one &")).To(Succeed())
+		Expect(execLine("fail &")).To(Succeed())
+		Eventually(shell.jobs.list()[1].Done()).Should(BeClosed())
+		stdout.Reset()
+		Expect(execLine("jobs")).To(Succeed())
+		Expect(stdout.String()).To(Equal("[1] Running  block one\n[2] Failed   fail\n"))
+		close(release)
+	})
+
+	It("Should display the output of a job brought to the foreground", func() {
+		Expect(execLine("block one &")).To(Succeed())
+		Eventually(shell.jobs.list()[0].Output).ShouldNot(BeEmpty())
+		stdout.Reset()
+
+		/* release the job once its buffered output has been displayed */
+		shell.SetOutputWriter(writerFunc(func(p []byte) (int, error) {
+			if bytes.Equal(p, []byte("[one]\n")) {
+				close(release)
+			}
+			return stdout.Write(p)
+		}))
+		Expect(execLine("fg %1")).To(Succeed())
+		Expect(stdout.String()).To(Equal("block one\n[one]\nreleased\n"))
+		Expect(shell.jobs.list()).To(BeEmpty())
+	})
+
+	It("Should return the error of a job brought to the foreground", func() {
+		Expect(execLine("fail &")).To(Succeed())
+		Expect(execLine("fg 1")).To(MatchError("failed"))
+	})
+
+	It("Should kill a job when the foreground is interrupted", func() {
+		Expect(execLine("block one &")).To(Succeed())
+		job := shell.jobs.list()[0]
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(fgCommand(ctx, &Invocation{Args: []string{"1"}, Shell: shell, Stdout: io.Discard})).To(Equal(context.Canceled))
+		Eventually(job.Done()).Should(BeClosed())
+		Expect(job.State()).To(Equal(JobKilled))
+	})
+
+	It("Should kill a job", func() {
+		Expect(execLine("block one &")).To(Succeed())
+		job := shell.jobs.list()[0]
+		Expect(execLine("kill 1")).To(Succeed())
+		Expect(job.State()).To(Equal(JobKilled))
+		Expect(job.Err()).To(Equal(context.Canceled))
+		Expect(shell.jobs.list()).To(BeEmpty())
+	})
+
+	It("Should kill the jobs and cancel later commands when the Shell is closed", func() {
+		Expect(execLine("block one &")).To(Succeed())
+		job := shell.jobs.list()[0]
+		Expect(shell.Close()).To(Succeed())
+		Eventually(job.Done()).Should(BeClosed())
+		Expect(job.State()).To(Equal(JobKilled))
+
+		var err error
+		shell.execInterruptible(nil, func(ctx context.Context) error {
+			err = ctx.Err()
+			return err
+		})
+		Expect(err).To(Equal(context.Canceled))
+	})
+
+	It("Should not reuse job numbers", func() {
+		Expect(execLine("fail &")).To(Succeed())
+		Expect(execLine("fail &")).To(Succeed())
+		Expect(execLine("kill 1")).To(Succeed())
+		Expect(execLine("fail &")).To(Succeed())
+		Expect(execLine("kill 2; kill 3")).To(Succeed())
+		Expect(execLine("fail &")).To(Succeed())
+		Expect(shell.jobs.list()[0].ID()).To(Equal(4))
+	})
+
+	It("Should require a valid job id", func() {
+		Expect(execLine("fg")).To(MatchError(ErrMissingJobID))
+		err := execLine("kill 1")
+		Expect(errors.Is(err, ErrNoSuchJob)).To(BeTrue())
+		Expect(err).To(MatchError("no such job: 1"))
+		Expect(execLine("fg x")).To(MatchError(&NoSuchJobError{ID: "x"}))
+	})
+
+	It("Should only allow & at the end of the line", func() {
+		Expect(execLine("echo one & echo two")).To(MatchError(ErrMisplacedBackground))
+		Expect(execLine("&")).To(MatchError(ErrEmptyCommand))
+	})
+
+	It("Should report completed jobs before the next prompt", func() {
+		prompt := newTestPrompt()
+		shell.SetPrompt(prompt)
+		Expect(execLine("fail &")).To(Succeed())
+		Eventually(shell.jobs.list()[0].Done()).Should(BeClosed())
+		stdout.Reset()
+		prompt.lineEditor.addResponse("", nil)
+		prompt.lineEditor.end()
+		shell.Exec()
+		Expect(stdout.String()).To(Equal("[1] Failed   fail\n"))
+		Expect(shell.jobs.list()).To(HaveLen(1))
+	})
+
+	It("Should keep the output of a reported job for fg", func() {
+		prompt := newTestPrompt()
+		shell.SetPrompt(prompt)
+		Expect(execLine("echo hello &")).To(Succeed())
+		Eventually(shell.jobs.list()[0].Done()).Should(BeClosed())
+		stdout.Reset()
+		prompt.lineEditor.addResponse("", nil)
+		prompt.lineEditor.addResponse("fg 1", nil)
+		prompt.lineEditor.end()
+		shell.Exec()
+		Expect(stderr.String()).To(BeEmpty())
+		Expect(stdout.String()).To(Equal("[1] Done     echo hello\necho hello\nhello\n"))
+		Expect(shell.jobs.list()).To(BeEmpty())
+	})
+
+	It("Should only keep the end of a job's output", func() {
+		line := bytes.Repeat([]byte("x"), 1000)
+		Expect(execLine("block one &")).To(Succeed())
+		job := shell.jobs.list()[0]
+		Eventually(job.Output).ShouldNot(BeEmpty())
+		for i := 0; i < 2*JobOutputSize/len(line); i++ {
+			job.write(line)
+		}
+		job.write([]byte("end\n"))
+		Expect(job.Output()).To(HaveLen(JobOutputSize))
+		Expect(job.Output()).To(HaveSuffix("xend\n"))
+
+		stdout.Reset()
+		close(release)
+		Expect(execLine("fg 1")).To(Succeed())
+		Expect(stdout.Len()).To(BeNumerically("<=", len("block one\n")+JobOutputSize+len("released\n")))
+		Expect(stdout.String()).To(HaveSuffix("xend\nreleased\n"))
+	})
+})
@@ -0,0 +1,209 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	operatorToken
+)
+
+const (
+	pipeOperator       = "|"
+	redirectOperator   = ">"
+	appendOperator     = ">>"
+	sequenceOperator   = ";"
+	andOperator        = "&&"
+	orOperator         = "||"
+	backgroundOperator = "&"
+)
+
+// shellOperators are the unquoted character sequences that the Shell treats
+// as operators rather than as part of a field.  Longer operators must come
+// before any operator that is a prefix of them
+var shellOperators = []string{orOperator, pipeOperator, appendOperator, redirectOperator, sequenceOperator, andOperator, backgroundOperator}
+
+// token is a single field or operator of an input line
+//
+// start and end are the byte offsets of the raw token in the line, including
+// any quotes and escapes.  If the line ended before a quote was closed then
+// quote is set to the open quote character
+type token struct {
+	kind  tokenKind
+	value string
+	start int
+	end   int
+	quote rune
+}
+
+// lex breaks the line into tokens
+//
+// Any unquoted occurrence of one of the operators is returned as an operator
+// token, whether or not it is surrounded by whitespace.  When more than one
+// operator matches, the first in the list wins.  If the line ends inside a
+// quote or after an escape, the partial token is still returned along with
+// the corresponding error so that the completer can work with incomplete
+// input
+func lex(line string, operators []string) ([]token, error) {
+	var tokens []token
+	var value strings.Builder
+	var quote rune
+	inToken := false
+	escaped := false
+	start := 0
+
+	begin := func(i int) {
+		if !inToken {
+			inToken = true
+			start = i
+		}
+	}
+
+	emit := func(i int) {
+		if inToken {
+			tokens = append(tokens, token{value: value.String(), start: start, end: i})
+			value.Reset()
+			inToken = false
+		}
+	}
+
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		operator := ""
+		if !escaped && quote == 0 {
+			operator = matchOperator(line[i:], operators)
+		}
+
+		switch {
+		case operator != "":
+			emit(i)
+			tokens = append(tokens, token{kind: operatorToken, value: operator, start: i, end: i + len(operator)})
+			size = len(operator)
+		case escaped:
+			/* inside double quotes, a backslash only escapes
+			 * a double quote or another backslash
+			 */
+			if quote == '"' && r != '"' && r != '\\' {
+				value.WriteByte('\\')
+			}
+			value.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				value.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escaped = true
+			} else {
+				value.WriteRune(r)
+			}
+		case r == '\\':
+			begin(i)
+			escaped = true
+		case r == '\'' || r == '"':
+			begin(i)
+			quote = r
+		case unicode.IsSpace(r):
+			emit(i)
+		default:
+			begin(i)
+			value.WriteRune(r)
+		}
+		i += size
+	}
+
+	if inToken {
+		tokens = append(tokens, token{value: value.String(), start: start, end: len(line), quote: quote})
+	}
+
+	if quote != 0 {
+		return tokens, ErrUnterminatedQuote
+	} else if escaped {
+		return tokens, ErrUnterminatedEscape
+	}
+	return tokens, nil
+}
+
+func matchOperator(input string, operators []string) string {
+	for _, operator := range operators {
+		if strings.HasPrefix(input, operator) {
+			return operator
+		}
+	}
+	return ""
+}
+
+// Split breaks a line of input into fields the same way a traditional shell
+// would
+//
+// Fields are separated by unquoted whitespace.  Single quotes preserve the
+// literal value of every character they enclose.  Double quotes do the same
+// except that a backslash may be used to escape a double quote or another
+// backslash.  Outside of quotes, a backslash preserves the literal value of
+// the character that follows it.  A quoted empty string is an empty field.
+// ErrUnterminatedQuote is returned if a quote is never closed and
+// ErrUnterminatedEscape is returned if the line ends with a backslash
+func Split(line string) ([]string, error) {
+	tokens, err := lex(line, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, len(tokens))
+	for i, token := range tokens {
+		fields[i] = token.value
+	}
+	return fields, nil
+}
+
+// quoteField escapes a value so that lex returns it as a single field.  If
+// quote is non-zero then the field is being written inside of an open quote
+// of that type
+func quoteField(value string, quote rune) string {
+	var builder strings.Builder
+	for _, r := range value {
+		switch quote {
+		case '\'':
+			if r == '\'' {
+				builder.WriteString(`'\''`)
+				continue
+			}
+		case '"':
+			if r == '"' || r == '\\' {
+				builder.WriteByte('\\')
+			}
+		default:
+			if unicode.IsSpace(r) || strings.ContainsRune(`'"\|>;&`, r) {
+				builder.WriteByte('\\')
+			}
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
@@ -0,0 +1,142 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Split", func() {
+	It("Should split fields on whitespace", func() {
+		Expect(Split("  show \tinterface  eth0 ")).To(Equal([]string{"show", "interface", "eth0"}))
+	})
+
+	It("Should return no fields for a blank line", func() {
+		Expect(Split("   ")).To(BeEmpty())
+	})
+
+	It("Should keep double quoted strings together", func() {
+		Expect(Split(`set description "uplink to core"`)).To(Equal([]string{"set", "description", "uplink to core"}))
+	})
+
+	It("Should keep single quoted strings together", func() {
+		Expect(Split(`set description 'uplink to core'`)).To(Equal([]string{"set", "description", "uplink to core"}))
+	})
+
+	It("Should join quoted and unquoted text in the same field", func() {
+		Expect(Split(`a"b c"d'e f'`)).To(Equal([]string{"ab cde f"}))
+	})
+
+	It("Should return empty fields for empty quotes", func() {
+		Expect(Split(`set description "" ''`)).To(Equal([]string{"set", "description", "", ""}))
+	})
+
+	It("Should escape characters outside of quotes", func() {
+		Expect(Split(`uplink\ to\ core \"quoted\" back\\slash`)).To(Equal([]string{"uplink to core", `"quoted"`, `back\slash`}))
+	})
+
+	It("Should only escape quotes and backslashes inside double quotes", func() {
+		Expect(Split(`"a \"b\" \\ \n"`)).To(Equal([]string{`a "b" \ \n`}))
+	})
+
+	It("Should not escape anything inside single quotes", func() {
+		Expect(Split(`'a \" b'`)).To(Equal([]string{`a \" b`}))
+	})
+
+	It("Should return an error for an unterminated quote", func() {
+		_, err := Split(`set description "uplink`)
+		Expect(err).To(MatchError(ErrUnterminatedQuote))
+		_, err = Split(`set description 'uplink`)
+		Expect(err).To(MatchError(ErrUnterminatedQuote))
+	})
+
+	It("Should return an error for an unterminated escape", func() {
+		_, err := Split(`show \`)
+		Expect(err).To(MatchError(ErrUnterminatedEscape))
+	})
+})
+
+var _ = Describe("lex", func() {
+	It("Should record the position of each token", func() {
+		tokens, err := lex(`ab "c d" e`, nil)
+		Expect(err).To(BeNil())
+		Expect(tokens).To(Equal([]token{
+			{value: "ab", start: 0, end: 2},
+			{value: "c d", start: 3, end: 8},
+			{value: "e", start: 9, end: 10},
+		}))
+	})
+
+	It("Should return operators as separate tokens", func() {
+		tokens, err := lex(`a|b | "c|d" e\|f`, shellOperators)
+		Expect(err).To(BeNil())
+		Expect(tokens).To(Equal([]token{
+			{value: "a", start: 0, end: 1},
+			{kind: operatorToken, value: "|", start: 1, end: 2},
+			{value: "b", start: 2, end: 3},
+			{kind: operatorToken, value: "|", start: 4, end: 5},
+			{value: "c|d", start: 6, end: 11},
+			{value: "e|f", start: 12, end: 16},
+		}))
+	})
+
+	It("Should prefer the longest operator", func() {
+		tokens, err := lex(`a||b&&c;d&`, shellOperators)
+		Expect(err).To(BeNil())
+		Expect(tokens).To(Equal([]token{
+			{value: "a", start: 0, end: 1},
+			{kind: operatorToken, value: "||", start: 1, end: 3},
+			{value: "b", start: 3, end: 4},
+			{kind: operatorToken, value: "&&", start: 4, end: 6},
+			{value: "c", start: 6, end: 7},
+			{kind: operatorToken, value: ";", start: 7, end: 8},
+			{value: "d", start: 8, end: 9},
+			{kind: operatorToken, value: "&", start: 9, end: 10},
+		}))
+	})
+
+	It("Should not recognize operators when none are given", func() {
+		Expect(Split("a | b")).To(Equal([]string{"a", "|", "b"}))
+	})
+
+	It("Should return a partial token for an open quote", func() {
+		tokens, err := lex(`ab "c d`, nil)
+		Expect(err).To(MatchError(ErrUnterminatedQuote))
+		Expect(tokens[1]).To(Equal(token{value: "c d", start: 3, end: 7, quote: '"'}))
+	})
+})
+
+var _ = Describe("quoteField", func() {
+	It("Should escape special characters in an unquoted field", func() {
+		Expect(quoteField(`a b"c`, 0)).To(Equal(`a\ b\"c`))
+	})
+
+	It("Should escape double quotes in a double quoted field", func() {
+		Expect(quoteField(`a "b"`, '"')).To(Equal(`a \"b\"`))
+	})
+
+	It("Should round trip through Split", func() {
+		for _, value := range []string{`a b`, `it's`, `"x" \ y`, `a|b`, `a;b&&c`} {
+			tokens, _ := lex(quoteField(value, 0), shellOperators)
+			Expect(tokens).To(HaveLen(1))
+			Expect(tokens[0].value).To(Equal(value))
+			Expect(Split(`"` + quoteField(value, '"') + `"`)).To(Equal([]string{value}))
+			Expect(Split(`'` + quoteField(value, '\'') + `'`)).To(Equal([]string{value}))
+		}
+	})
+})
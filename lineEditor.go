@@ -17,7 +17,13 @@
 package gosh
 
 import (
-	"github.com/peterh/liner"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
 )
 
 // LineEditor wraps the basic Prompt method
@@ -25,38 +31,126 @@ type LineEditor interface {
 	Prompt(string) (string, error)
 }
 
-// DefaultLineEditor is a concrete implementation of LineEditor that uses
-// github.com/peterh/liner as the line editor
+// DefaultLineEditor is a concrete implementation of LineEditor for the
+// terminal of the process.  It edits lines with a TerminalLineEditor, so Tab
+// completion, ? help and history work the same as they do for a remote
+// terminal
+//
+// The terminal is only in raw mode while the user is being prompted, so
+// commands read the terminal normally while they execute.  When the standard
+// input is not a terminal the prompt is written and lines are read without
+// any editing
 type DefaultLineEditor struct {
-	liner *liner.State
+	editor *TerminalLineEditor
+	fd     int
+	reader *bufio.Reader
+	output io.Writer
 }
 
 // Prompt will prompt the user with the prompt string, collect the response and
-// return it.  If the upstream liner.Prompt function succeeds, then the
-// response is added to the history.  The collected string and any associated
-// error is returned
+// return it.  Non-empty responses are added to the history.  The collected
+// string and any associated error is returned.  If the user presses Ctrl-C
+// then the line is discarded and ErrInterrupted is returned
 func (d *DefaultLineEditor) Prompt(prompt string) (string, error) {
-	str, err := d.liner.Prompt(prompt)
-	if err == nil {
-		d.liner.AppendHistory(str)
+	if d.editor == nil {
+		fmt.Fprint(d.output, prompt)
+		return d.readLine()
+	}
+
+	restore, err := d.makeRaw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	return d.editor.Prompt(prompt)
+}
+
+// PromptPassword prompts for a password without echoing it.  If the user
+// presses Ctrl-C then ErrInterrupted is returned
+func (d *DefaultLineEditor) PromptPassword(prompt string) (string, error) {
+	if d.editor == nil {
+		fmt.Fprint(d.output, prompt)
+		return d.readLine()
+	}
+
+	restore, err := d.makeRaw()
+	if err != nil {
+		return "", err
 	}
-	return str, err
+	defer restore()
+	return d.editor.PromptPassword(prompt)
 }
 
-// Close returns the terminal to the original state.  This includes taking the
-// terminal out of raw mode and turning echo back on
+// Close releases the line editor.  The terminal is already in its original
+// state, since it is only in raw mode during a prompt
 func (d *DefaultLineEditor) Close() error {
-	return d.liner.Close()
+	return nil
+}
+
+// makeRaw puts the terminal into raw mode and follows the size of its window
+// until the returned function is called
+func (d *DefaultLineEditor) makeRaw() (func(), error) {
+	if d.fd < 0 {
+		return func() {}, nil
+	}
+
+	state, err := term.MakeRaw(d.fd)
+	if err != nil {
+		return nil, err
+	}
+
+	d.resize()
+	stop := watchSize(d.resize)
+	return func() {
+		stop()
+		term.Restore(d.fd, state)
+	}, nil
+}
+
+// resize sets the size of the line editor to the size of the terminal
+func (d *DefaultLineEditor) resize() {
+	if width, height, err := term.GetSize(d.fd); err == nil && width > 0 {
+		d.editor.SetSize(width, height)
+	}
+}
+
+// readLine returns the next line of the input without its line ending.  A
+// final line without a line ending is returned before io.EOF
+func (d *DefaultLineEditor) readLine() (string, error) {
+	line, err := d.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// isLiteral reports whether a character typed at the end of the line is
+// quoted or escaped
+func isLiteral(line string) bool {
+	tokens, err := lex(line, shellOperators)
+	if err == ErrUnterminatedEscape {
+		return true
+	}
+	return len(tokens) > 0 && tokens[len(tokens)-1].quote != 0
 }
 
 // NewDefaultLineEditor returns a fully initialized line editor that includes
 // autocompletion and history
 func NewDefaultLineEditor(commands CommandMap) *DefaultLineEditor {
-	l := liner.NewLiner()
-	l.SetTabCompletionStyle(liner.TabPrints)
-	completer := newCompleter(commands)
-	l.SetWordCompleter(completer.complete)
+	return newDefaultLineEditor(newCompleter(commands))
+}
+
+func newDefaultLineEditor(completer *completer) *DefaultLineEditor {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return &DefaultLineEditor{fd: -1, reader: bufio.NewReader(os.Stdin), output: os.Stdout}
+	}
+
 	return &DefaultLineEditor{
-		liner: l,
+		editor: newTerminalLineEditor(completer, struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}),
+		fd: fd,
 	}
 }
@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || openbsd || freebsd || netbsd || solaris)
+
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+// watchSize does nothing, since there is no signal when the window changes
+// size.  The size is read at the start of every prompt instead
+func watchSize(resize func()) func() {
+	return func() {}
+}
@@ -71,19 +71,44 @@ type nonCloseableLineEditor struct{}
 func (t *nonCloseableLineEditor) Prompt(string) (string, error) { return "", nil }
 
 var _ = Describe("DefaultLineEditor", func() {
-	It("Should append the last command to the history", func() {
+	It("Should read lines without editing when the input is not a terminal", func() {
 		var b bytes.Buffer
 
 		stdinR, stdinWr, _ := os.Pipe()
 		oldStdin := os.Stdin
 		os.Stdin = stdinR
-
 		editor := NewDefaultLineEditor(CommandMap{})
-
-		stdinWr.Write([]byte("cmd\n"))
-		editor.Prompt(">")
 		os.Stdin = oldStdin
-		editor.liner.WriteHistory(&b)
-		Expect(b.String()).To(Equal("cmd\n"))
+		editor.output = &b
+
+		stdinWr.Write([]byte("cmd\r\nsecret\nlast"))
+		stdinWr.Close()
+		Expect(editor.Prompt(">")).To(Equal("cmd"))
+		Expect(editor.PromptPassword("Password: ")).To(Equal("secret"))
+		Expect(editor.Prompt(">")).To(Equal("last"))
+		_, err := editor.Prompt(">")
+		Expect(err).To(Equal(io.EOF))
+		Expect(b.String()).To(Equal(">Password: >>"))
+		Expect(editor.Close()).To(Succeed())
+	})
+
+	It("Should edit lines on a terminal", func() {
+		var output bytes.Buffer
+		input := &bytes.Buffer{}
+		commands := CommandMap{
+			"show": &describedCommand{description: Description{Summary: "Show the configuration"}},
+		}
+		editor := &DefaultLineEditor{
+			editor: newTerminalLineEditor(newCompleter(commands), struct {
+				io.Reader
+				io.Writer
+			}{input, &output}),
+			fd: -1,
+		}
+
+		input.WriteString("sh config\x01\x06\x06?\r")
+		Expect(editor.Prompt("> ")).To(Equal("sh config"))
+		Expect(output.String()).To(ContainSubstring("> sh?\r\n  show  Show the configuration\r\n> sh config\x1b[7D"))
+		Expect(editor.editor.history.At(0)).To(Equal("sh config"))
 	})
 })
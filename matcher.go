@@ -0,0 +1,116 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Matcher decides whether a typed word matches a name
+//
+// A Matcher reports whether word matches name along with a rank.  A rank of
+// zero means that the word is the whole name, for instance "SHOW" is the
+// whole name "show" for a case-insensitive matcher.  Higher ranks are weaker
+// matches.  Completion candidates are listed in order of rank and commands are
+// resolved using the best ranked match
+type Matcher func(word, name string) (rank int, ok bool)
+
+// PrefixMatch matches names that begin with the word.  It is the default
+// Matcher
+func PrefixMatch(word, name string) (int, bool) {
+	if word == name {
+		return 0, true
+	}
+	return 1, strings.HasPrefix(name, word)
+}
+
+// CaseInsensitiveMatch matches names that begin with the word, ignoring case
+func CaseInsensitiveMatch(word, name string) (int, bool) {
+	return PrefixMatch(strings.ToLower(word), strings.ToLower(name))
+}
+
+// SubstringMatch matches names that contain the word.  Names that begin with
+// the word are ranked ahead of other names
+func SubstringMatch(word, name string) (int, bool) {
+	if rank, ok := PrefixMatch(word, name); ok {
+		return rank, true
+	}
+	return 2, strings.Contains(name, word)
+}
+
+// FuzzyMatch matches names that contain the characters of the word in order,
+// ignoring case, so that "shint" matches "show-interface".  Exact, prefix and
+// substring matches are ranked first, followed by the names where the
+// characters of the word are closest together
+func FuzzyMatch(word, name string) (int, bool) {
+	word, name = strings.ToLower(word), strings.ToLower(name)
+	if rank, ok := SubstringMatch(word, name); ok {
+		return rank, true
+	}
+
+	/* every character of name that is skipped
+	 * between matched characters is a gap
+	 */
+	gaps := 0
+	started := false
+	for _, r := range word {
+		i := strings.IndexRune(name, r)
+		if i < 0 {
+			return 0, false
+		}
+
+		if started {
+			gaps += utf8.RuneCountInString(name[:i])
+		}
+		started = true
+		name = name[i+utf8.RuneLen(r):]
+	}
+	return 3 + gaps, true
+}
+
+// matchCandidates returns the candidates whose values match word, ordered by
+// rank and then by value.  Only the first candidate with each value is kept
+func matchCandidates(candidates []Candidate, word string, matcher Matcher) []Candidate {
+	type match struct {
+		Candidate
+		rank int
+	}
+
+	seen := make(map[string]bool)
+	matches := []match{}
+	for _, candidate := range candidates {
+		if rank, ok := matcher(word, candidate.Value); ok && !seen[candidate.Value] {
+			seen[candidate.Value] = true
+			matches = append(matches, match{candidate, rank})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].Value < matches[j].Value
+	})
+
+	var result []Candidate
+	for _, match := range matches {
+		result = append(result, match.Candidate)
+	}
+	return result
+}
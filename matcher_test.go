@@ -0,0 +1,141 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Matchers", func() {
+	It("Should rank exact matches ahead of other matches", func() {
+		tests := []struct {
+			matcher Matcher
+			word    string
+			name    string
+			rank    int
+			ok      bool
+		}{
+			{PrefixMatch, "show", "show", 0, true},
+			{PrefixMatch, "sh", "show", 1, true},
+			{PrefixMatch, "SH", "show", 1, false},
+			{CaseInsensitiveMatch, "SHOW", "show", 0, true},
+			{CaseInsensitiveMatch, "Sh", "sHOW", 1, true},
+			{CaseInsensitiveMatch, "ow", "show", 1, false},
+			{SubstringMatch, "sh", "show", 1, true},
+			{SubstringMatch, "ow", "show", 2, true},
+			{SubstringMatch, "sw", "show", 2, false},
+			{FuzzyMatch, "SHOW", "show", 0, true},
+			{FuzzyMatch, "ow", "show", 2, true},
+			{FuzzyMatch, "sw", "show", 5, true},
+			{FuzzyMatch, "shint", "show-interface", 6, true},
+			{FuzzyMatch, "ws", "show", 0, false},
+		}
+
+		for _, test := range tests {
+			rank, ok := test.matcher(test.word, test.name)
+			Expect(ok).To(Equal(test.ok), "%q %q", test.word, test.name)
+			if ok {
+				Expect(rank).To(Equal(test.rank), "%q %q", test.word, test.name)
+			}
+		}
+	})
+
+	Describe("Find", func() {
+		var commands CommandMap
+		var command *testCommand
+
+		BeforeEach(func() {
+			command = newTestCommand()
+			commands = CommandMap{
+				"show": NewTreeCommand(CommandMap{
+					"interface":  command,
+					"interfaces": newTestCommand(),
+				}),
+			}
+		})
+
+		It("Should find whole names with the matcher", func() {
+			found, _, err := commands.Find([]string{"SHOW", "Interface"}, WithMatcher(CaseInsensitiveMatch))
+			Expect(err).To(BeNil())
+			Expect(found).To(BeIdenticalTo(command))
+
+			_, _, err = commands.Find([]string{"SH", "INTERFACE"}, WithMatcher(CaseInsensitiveMatch))
+			Expect(err).To(Equal(ErrNoMatchingCommand))
+		})
+
+		It("Should abbreviate names with the matcher", func() {
+			found, _, err := commands.Find([]string{"SH", "INTERFACE"}, WithMatcher(CaseInsensitiveMatch), AllowAbbreviations())
+			Expect(err).To(BeNil())
+			Expect(found).To(BeIdenticalTo(command))
+		})
+
+		It("Should find the best ranked name", func() {
+			found, _, err := commands.Find([]string{"sw", "interface"}, WithMatcher(FuzzyMatch), AllowAbbreviations())
+			Expect(err).To(BeNil())
+			Expect(found).To(BeIdenticalTo(command))
+
+			_, _, err = commands.Find([]string{"show", "face"}, WithMatcher(SubstringMatch), AllowAbbreviations())
+			Expect(err).To(Equal(&AmbiguousCommandError{Name: "face", Candidates: []string{"interface", "interfaces"}}))
+		})
+	})
+
+	Describe("Shell", func() {
+		var shell *Shell
+		var command *testCommand
+		var stdout bytes.Buffer
+
+		BeforeEach(func() {
+			command = newTestCommand()
+			shell = NewShell(CommandMap{
+				"show": NewTreeCommand(CommandMap{
+					"interface": command,
+				}),
+				"shutdown":  newTestCommand(),
+				"fish":      newTestCommand(),
+				"ssh":       newTestCommand(),
+				"switch-hw": newTestCommand(),
+			})
+			stdout.Reset()
+			shell.SetOutputWriter(&stdout)
+		})
+
+		It("Should not accept a nil matcher", func() {
+			Expect(shell.SetMatcher(nil)).To(Equal(ErrNilCallback))
+		})
+
+		It("Should execute commands matched by the matcher", func() {
+			Expect(shell.SetMatcher(CaseInsensitiveMatch)).To(Succeed())
+			shell.SetAbbreviations(true)
+			Expect(shell.Run([]string{"SHOW", "INT", "eth0", "|", "INCLUDE", "x"})).To(Equal(ExitSuccess))
+			Expect(command.arguments).To(Equal([]string{"eth0"}))
+		})
+
+		It("Should complete words with the matcher", func() {
+			Expect(shell.SetMatcher(CaseInsensitiveMatch)).To(Succeed())
+			_, completions, _ := shell.completer.complete("SHOW IN", 7)
+			Expect(completions).To(Equal([]string{"interface"}))
+		})
+
+		It("Should order fuzzy completions by rank", func() {
+			Expect(shell.SetMatcher(FuzzyMatch)).To(Succeed())
+			_, completions, _ := shell.completer.complete("sh", 2)
+			Expect(completions).To(Equal([]string{"show", "shutdown", "fish", "ssh", "switch-hw"}))
+		})
+	})
+})
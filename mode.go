@@ -0,0 +1,225 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Mode is a command mode, such as the configuration mode of a network
+// appliance
+//
+// While a Mode is active its Commands replace the commands that the Shell was
+// created with.  The Shell's builtins remain available along with exit, which
+// returns to the previous mode, and end, which returns to the commands the
+// Shell was created with.  Name identifies the mode in the prompt, for
+// instance "config" or "config-if".  Prompter, if set, replaces the prompter
+// while the mode is active.  Value holds any data the mode's commands need,
+// such as the name of the interface being configured
+type Mode struct {
+	Name     string
+	Commands CommandMap
+	Prompter Prompter
+	Value    interface{}
+}
+
+// modeEntry is the path of the command that entered a mode and the commands
+// it was found in.  The path is nil for modes entered with PushMode
+type modeEntry struct {
+	commands CommandMap
+	path     []string
+}
+
+// EnterMode returns a command that enters mode when it is executed.  For
+// instance, configure terminal can be declared as:
+//
+//	"configure": gosh.NewTreeCommand(gosh.CommandMap{
+//		"terminal": gosh.EnterMode(configMode),
+//	})
+//
+// If the Shell's privileges later change so that the command may no longer
+// be used, such as after disable, then the mode and any mode entered from it
+// are left
+func EnterMode(mode *Mode) Command {
+	return CommandFunc(func(ctx context.Context, inv *Invocation) error {
+		if inv.Shell == nil {
+			return ErrNoShell
+		}
+		inv.Shell.pushMode(mode, append([]string(nil), inv.Path...))
+		return nil
+	})
+}
+
+// newModeBuiltins returns the builtins that are only available in a Mode
+func newModeBuiltins() CommandMap {
+	return CommandMap{
+		"end": describedFunc{endCommand, Description{
+			Summary: "Return to the top level commands",
+		}},
+		"exit": describedFunc{exitCommand, Description{
+			Summary: "Return to the previous mode",
+		}},
+	}
+}
+
+// exitCommand leaves the current mode
+func exitCommand(ctx context.Context, inv *Invocation) error {
+	if inv.Shell == nil {
+		return ErrNoShell
+	}
+	inv.Shell.PopMode()
+	return nil
+}
+
+// endCommand leaves every mode
+func endCommand(ctx context.Context, inv *Invocation) error {
+	if inv.Shell == nil {
+		return ErrNoShell
+	}
+	inv.Shell.ResetMode()
+	return nil
+}
+
+// PushMode enters mode.  The mode's commands are used for the following
+// command lines until the mode is left with PopMode or ResetMode
+func (shell *Shell) PushMode(mode *Mode) {
+	shell.pushMode(mode, nil)
+}
+
+// pushMode enters mode from the command at path in the current commands
+func (shell *Shell) pushMode(mode *Mode, path []string) {
+	shell.modeLock.Lock()
+	entry := modeEntry{commands: shell.commands, path: path}
+	if len(shell.modes) > 0 {
+		entry.commands = shell.modes[len(shell.modes)-1].Commands
+	}
+	shell.modes = append(shell.modes, mode)
+	shell.modeEntries = append(shell.modeEntries, entry)
+	shell.modeLock.Unlock()
+	shell.updateMode()
+}
+
+// PopMode leaves the current mode and returns to the previous one.  It
+// returns false if no mode is active
+func (shell *Shell) PopMode() bool {
+	shell.modeLock.Lock()
+	if len(shell.modes) == 0 {
+		shell.modeLock.Unlock()
+		return false
+	}
+	shell.modes = shell.modes[:len(shell.modes)-1]
+	shell.modeEntries = shell.modeEntries[:len(shell.modeEntries)-1]
+	shell.modeLock.Unlock()
+	shell.updateMode()
+	return true
+}
+
+// ResetMode leaves every mode and returns to the commands the Shell was
+// created with
+func (shell *Shell) ResetMode() {
+	shell.modeLock.Lock()
+	shell.modes = nil
+	shell.modeEntries = nil
+	shell.modeLock.Unlock()
+	shell.updateMode()
+}
+
+// leaveForbiddenModes leaves the first mode whose entry command may no longer
+// be used with the Shell's privileges along with every mode entered from it
+func (shell *Shell) leaveForbiddenModes() {
+	shell.modeLock.Lock()
+	entries := append([]modeEntry(nil), shell.modeEntries...)
+	shell.modeLock.Unlock()
+
+	options := newFindOptions(shell.findOptions())
+	for i, entry := range entries {
+		if entry.path == nil {
+			continue
+		}
+
+		if _, _, _, err := entry.commands.find(entry.path, options); errors.Is(err, ErrPermissionDenied) {
+			shell.modeLock.Lock()
+			if i < len(shell.modes) {
+				shell.modes = shell.modes[:i]
+				shell.modeEntries = shell.modeEntries[:i]
+			}
+			shell.modeLock.Unlock()
+			shell.updateMode()
+			return
+		}
+	}
+}
+
+// Mode returns the current mode, or nil if no mode is active
+func (shell *Shell) Mode() *Mode {
+	shell.modeLock.Lock()
+	defer shell.modeLock.Unlock()
+	if len(shell.modes) == 0 {
+		return nil
+	}
+	return shell.modes[len(shell.modes)-1]
+}
+
+// Modes returns the active modes, starting with the first mode that was
+// entered
+func (shell *Shell) Modes() []*Mode {
+	shell.modeLock.Lock()
+	defer shell.modeLock.Unlock()
+	return append([]*Mode(nil), shell.modes...)
+}
+
+// updateMode switches the completer and the prompter to the current mode
+func (shell *Shell) updateMode() {
+	mode := shell.Mode()
+	shell.completer.mode = mode
+	if mode == nil {
+		shell.completer.topLevelCommands = shell.commands
+		shell.completer.builtins = shell.builtins
+	} else {
+		shell.completer.topLevelCommands = mode.Commands
+		shell.completer.builtins = mergeCommands(shell.modeBuiltins, shell.builtins)
+	}
+
+	if prompt, ok := shell.prompt.(*DefaultPrompt); ok {
+		prompt.SetPrompter(shell.modePrompter(mode))
+	}
+}
+
+// modePrompter returns the prompter for mode.  Unless the mode has its own
+// prompter, the mode's name is inserted before the last character of the
+// Shell's prompt, so that "router#" becomes "router(config)#"
+func (shell *Shell) modePrompter(mode *Mode) Prompter {
+	prompter := shell.prompter
+	switch {
+	case mode == nil:
+		return prompter
+	case mode.Prompter != nil:
+		return mode.Prompter
+	}
+
+	return func() string {
+		prompt := prompter()
+		trimmed := strings.TrimRight(prompt, " ")
+		if trimmed == "" {
+			return "(" + mode.Name + ")" + prompt
+		}
+		last := len(trimmed) - 1
+		return trimmed[:last] + "(" + mode.Name + ")" + prompt[last:]
+	}
+}
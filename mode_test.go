@@ -0,0 +1,153 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = Describe("Modes", func() {
+	var shell *Shell
+	var stdout, stderr bytes.Buffer
+	var mtus map[string]string
+
+	prompt := func() string {
+		return shell.prompt.(*DefaultPrompt).prompter()
+	}
+
+	BeforeEach(func() {
+		mtus = make(map[string]string)
+		interfaceMode := CommandMap{
+			"mtu": CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				mtus[inv.Shell.Mode().Value.(string)] = inv.Args[0]
+				return nil
+			}),
+		}
+
+		configMode := &Mode{Name: "config", Commands: CommandMap{
+			"interface": CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				inv.Shell.PushMode(&Mode{Name: "config-if", Commands: interfaceMode, Value: inv.Args[0]})
+				return nil
+			}),
+			"hostname": CommandFunc(echoCommand),
+		}}
+
+		shell = NewShell(CommandMap{
+			"configure": NewTreeCommand(CommandMap{
+				"terminal": EnterMode(configMode),
+			}),
+			"show": CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				fmt.Fprintf(inv.Stdout, "%v\n", mtus)
+				return nil
+			}),
+		})
+		stdout.Reset()
+		stderr.Reset()
+		shell.SetOutputWriter(&stdout)
+		shell.SetErrorWriter(&stderr)
+		shell.SetPrompter(func() string { return "router# " })
+	})
+
+	It("Should enter and leave modes", func() {
+		Expect(shell.Mode()).To(BeNil())
+		Expect(shell.RunScript(strings.NewReader("configure terminal\ninterface eth0\n"))).To(Succeed())
+		Expect(shell.Mode().Name).To(Equal("config-if"))
+		Expect(shell.Modes()).To(HaveLen(2))
+
+		Expect(shell.RunScript(strings.NewReader("mtu 9000\nexit\ninterface eth1\nmtu 1500\n"))).To(Succeed())
+		Expect(mtus).To(Equal(map[string]string{"eth0": "9000", "eth1": "1500"}))
+		Expect(shell.Modes()).To(HaveLen(2))
+
+		Expect(shell.RunScript(strings.NewReader("end\nshow\n"))).To(Succeed())
+		Expect(shell.Mode()).To(BeNil())
+		Expect(stdout.String()).To(Equal("map[eth0:9000 eth1:1500]\n"))
+	})
+
+	It("Should only execute the commands of the current mode", func() {
+		shell.RunScript(strings.NewReader("configure terminal\nshow\n"))
+		Expect(stderr.String()).To(ContainSubstring("no matching command"))
+
+		stderr.Reset()
+		shell.ResetMode()
+		shell.RunScript(strings.NewReader("exit\n"))
+		Expect(stderr.String()).To(ContainSubstring("no matching command"))
+	})
+
+	It("Should show the mode in the prompt", func() {
+		Expect(prompt()).To(Equal("router# "))
+		shell.RunScript(strings.NewReader("configure terminal\n"))
+		Expect(prompt()).To(Equal("router(config)# "))
+		shell.RunScript(strings.NewReader("interface eth0\n"))
+		Expect(prompt()).To(Equal("router(config-if)# "))
+		Expect(shell.PopMode()).To(BeTrue())
+		Expect(prompt()).To(Equal("router(config)# "))
+		shell.ResetMode()
+		Expect(prompt()).To(Equal("router# "))
+		Expect(shell.PopMode()).To(BeFalse())
+	})
+
+	It("Should use the mode's prompter", func() {
+		shell.PushMode(&Mode{Name: "shell", Prompter: func() string { return "$ " }})
+		Expect(prompt()).To(Equal("$ "))
+		shell.SetPrompter(func() string { return "switch>" })
+		Expect(prompt()).To(Equal("$ "))
+		shell.PopMode()
+		Expect(prompt()).To(Equal("switch>"))
+	})
+
+	It("Should complete the commands of the current mode", func() {
+		shell.RunScript(strings.NewReader("configure terminal\n"))
+		_, completions, _ := shell.completer.complete("", 0)
+		Expect(completions).To(Equal([]string{"disable", "enable", "end", "exit", "fg", "help", "hostname", "interface", "jobs", "kill", "source"}))
+
+		shell.RunScript(strings.NewReader("end\n"))
+		_, completions, _ = shell.completer.complete("", 0)
+		Expect(completions).To(Equal([]string{"configure", "disable", "enable", "fg", "help", "jobs", "kill", "show", "source"}))
+	})
+
+	It("Should leave the modes that the privileges no longer permit", func() {
+		shell.commands["configure"] = shell.commands["configure"].(TreeCommand).WithPrivilege(MaxPrivilege)
+		shell.SetPrivileges(Privileges{Level: MaxPrivilege})
+		Expect(shell.RunScript(strings.NewReader("configure terminal\ninterface eth0\n"))).To(Succeed())
+		Expect(shell.Modes()).To(HaveLen(2))
+
+		Expect(shell.RunScript(strings.NewReader("disable\n"))).To(Succeed())
+		Expect(shell.Mode()).To(BeNil())
+		Expect(prompt()).To(Equal("router# "))
+		shell.RunScript(strings.NewReader("mtu 9000\n"))
+		Expect(stderr.String()).To(ContainSubstring("no matching command"))
+		Expect(mtus).To(BeEmpty())
+	})
+
+	It("Should stay in modes that the privileges still permit", func() {
+		shell.PushMode(&Mode{Name: "shell"})
+		Expect(shell.RunScript(strings.NewReader("end\nconfigure terminal\n"))).To(Succeed())
+		shell.SetPrivileges(Privileges{Level: 0})
+		Expect(shell.Mode().Name).To(Equal("config"))
+	})
+
+	It("Should list the commands of the current mode in the help", func() {
+		shell.RunScript(strings.NewReader("configure terminal\nhelp\n"))
+		Expect(stdout.String()).To(ContainSubstring("  exit       Return to the previous mode\n"))
+		Expect(stdout.String()).To(ContainSubstring("  interface\n"))
+	})
+})
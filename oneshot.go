@@ -0,0 +1,211 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Process exit codes returned by Shell.Run
+const (
+	// ExitSuccess indicates the command completed successfully
+	ExitSuccess = 0
+
+	// ExitFailure indicates the command returned an error
+	ExitFailure = 1
+
+	// ExitUsage indicates the command line could not be parsed or did not
+	// name a command
+	ExitUsage = 2
+
+	// ExitTimeout indicates the command did not complete within its timeout
+	ExitTimeout = 124
+
+	// ExitInterrupted indicates the command was interrupted
+	ExitInterrupted = 130
+)
+
+// helpFlag requests usage information instead of executing a command
+const helpFlag = "--help"
+
+// ExitCoder is implemented by errors that determine their own process exit
+// code
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// ExitCode maps an error returned from executing a command to a process exit
+// code
+//
+// A nil error is ExitSuccess.  Errors that implement ExitCoder determine
+// their own exit code.  Commands that time out are ExitTimeout and
+// interrupted commands are ExitInterrupted.  Errors caused by the command line
+// itself, such as ErrNoMatchingCommand or ErrUnterminatedQuote, are
+// ExitUsage.  Every other error is ExitFailure
+func ExitCode(err error) int {
+	var exitCoder ExitCoder
+	switch {
+	case err == nil:
+		return ExitSuccess
+	case errors.As(err, &exitCoder):
+		return exitCoder.ExitCode()
+	case errors.Is(err, ErrTimeout):
+		return ExitTimeout
+	case errors.Is(err, ErrInterrupted) || errors.Is(err, ErrCommandAbandoned):
+		return ExitInterrupted
+	case isUsageError(err):
+		return ExitUsage
+	}
+	return ExitFailure
+}
+
+func isUsageError(err error) bool {
+	for _, usageErr := range []error{
+		ErrAmbiguousCommand,
+		ErrEmptyCommand,
+		ErrEmptyPipelineStage,
+		ErrIncompleteCommand,
+		ErrInvalidArgument,
+		ErrInvalidFlagValue,
+		ErrInvalidRedirect,
+		ErrMissingArgument,
+		ErrMissingFlagValue,
+		ErrNoMatchingCommand,
+		ErrRequiredFlag,
+		ErrUnexpectedArgument,
+		ErrUnknownFlag,
+		ErrUnterminatedEscape,
+		ErrUnterminatedQuote,
+	} {
+		if errors.Is(err, usageErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// argTokens converts a list of arguments to tokens.  Since the arguments have
+// already been split, only an argument that is exactly an operator is treated
+// as one
+func argTokens(args []string) []token {
+	tokens := make([]token, len(args))
+	for i, arg := range args {
+		tokens[i] = token{value: arg}
+		for _, operator := range shellOperators {
+			if arg == operator {
+				tokens[i].kind = operatorToken
+			}
+		}
+	}
+	return tokens
+}
+
+// Run executes a single command given as a list of arguments and returns a
+// process exit code
+//
+// Run allows a program to act as both an interactive shell and a one-shot
+// command, for instance by calling os.Exit(shell.Run(os.Args[1:])).  If args
+// is empty then the interactive shell is started with Exec.  Otherwise, the
+// arguments are resolved through the Shell's CommandMap and the command is
+// executed without starting the line editor.  An argument that is exactly an
+// operator, such as "|", is treated as one.
+//
+// If the arguments include --help then usage information for the command
+// named by the preceding arguments is written to the output writer instead
+// of executing it.  If the arguments name a TreeCommand without naming one of
+// its sub-commands, then the sub-commands are listed on the error writer and
+// ExitUsage is returned.  Since the process exits once Run returns, a command
+// line ending in & is executed in the foreground.  An interrupt (SIGINT)
+// cancels the command in the same way as it does in Exec.  Errors are written
+// to the error writer and mapped to the exit code with ExitCode
+func (shell *Shell) Run(args []string) int {
+	if len(args) == 0 {
+		shell.Exec()
+		return ExitSuccess
+	}
+
+	interrupts, stop := shell.catchInterrupts()
+	defer stop()
+
+	err := shell.execInterruptible(interrupts, func(ctx context.Context) error {
+		return shell.run(ctx, args)
+	})
+	if err != nil {
+		fmt.Fprintf(shell.errorWriter, "%v\n", err)
+
+		var incomplete *incompleteCommandError
+		var flagErr *FlagError
+		var paramErr *ParamError
+		if errors.As(err, &incomplete) {
+			shell.writeHelp(shell.errorWriter, shell.commandMap(), incomplete.path)
+		} else if errors.As(err, &flagErr) {
+			fmt.Fprintf(shell.errorWriter, "\n")
+			shell.writeHelp(shell.errorWriter, shell.commandMap(), flagErr.Path)
+		} else if errors.As(err, &paramErr) {
+			fmt.Fprintf(shell.errorWriter, "\n")
+			shell.writeHelp(shell.errorWriter, shell.commandMap(), paramErr.Path)
+		}
+	}
+	return ExitCode(err)
+}
+
+func (shell *Shell) run(ctx context.Context, args []string) error {
+	tokens, _ := splitBackground(argTokens(args))
+	c, err := parseChain(tokens)
+	if err != nil {
+		return err
+	}
+	return shell.execChain(ctx, shell.invocation(), c, shell.runPipeline)
+}
+
+// runPipeline executes a pipeline given on the command line, handling --help
+// and incomplete commands
+func (shell *Shell) runPipeline(ctx context.Context, inv *Invocation, p *pipeline) error {
+	fields := p.stages[0]
+	for i, field := range fields {
+		if field == helpFlag {
+			return shell.writeHelp(inv.Stdout, shell.commandMap(), fields[:i])
+		}
+	}
+
+	commands, options := shell.topLevel()
+	path, command, arguments, err := commands.find(fields, newFindOptions(options))
+	if err != nil {
+		return err
+	}
+
+	if tree, ok := command.(TreeCommand); ok && len(tree.SubCommands()) > 0 && len(arguments) == 0 {
+		return &incompleteCommandError{path}
+	}
+	return shell.execPipeline(ctx, inv, p)
+}
+
+// incompleteCommandError indicates that path names a TreeCommand rather than
+// one of its sub-commands
+type incompleteCommandError struct {
+	path []string
+}
+
+func (e *incompleteCommandError) Error() string {
+	return ErrIncompleteCommand.Error()
+}
+
+func (e *incompleteCommandError) Unwrap() error {
+	return ErrIncompleteCommand
+}
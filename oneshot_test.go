@@ -0,0 +1,158 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+type exitCodeError int
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit %d", int(e))
+}
+
+func (e exitCodeError) ExitCode() int {
+	return int(e)
+}
+
+var _ = Describe("ExitCode", func() {
+	It("Should map nil to ExitSuccess", func() {
+		Expect(ExitCode(nil)).To(Equal(ExitSuccess))
+	})
+
+	It("Should map command line errors to ExitUsage", func() {
+		Expect(ExitCode(ErrNoMatchingCommand)).To(Equal(ExitUsage))
+		Expect(ExitCode(&AmbiguousCommandError{Name: "s"})).To(Equal(ExitUsage))
+		Expect(ExitCode(&ScriptError{Line: 1, Err: ErrUnterminatedQuote})).To(Equal(ExitUsage))
+	})
+
+	It("Should let errors provide their own exit code", func() {
+		Expect(ExitCode(fmt.Errorf("wrapped: %w", exitCodeError(42)))).To(Equal(42))
+	})
+
+	It("Should map timeouts to ExitTimeout", func() {
+		Expect(ExitCode(&TimeoutError{Path: []string{"show"}})).To(Equal(ExitTimeout))
+	})
+
+	It("Should map other errors to ExitFailure", func() {
+		Expect(ExitCode(errors.New("failed"))).To(Equal(ExitFailure))
+	})
+})
+
+var _ = Describe("Run", func() {
+	var shell *Shell
+	var command *testCommand
+	var stdout, stderr bytes.Buffer
+
+	BeforeEach(func() {
+		command = newTestCommand()
+		shell = NewShell(CommandMap{
+			"show": NewTreeCommand(CommandMap{
+				"config":    outputCommand(testConfig),
+				"interface": command,
+			}),
+			"fail": CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				return exitCodeError(3)
+			}),
+		})
+		stdout.Reset()
+		stderr.Reset()
+		shell.SetOutputWriter(&stdout)
+		shell.SetErrorWriter(&stderr)
+	})
+
+	It("Should execute the command named by the arguments", func() {
+		Expect(shell.Run([]string{"show", "interface", "eth0 extra"})).To(Equal(ExitSuccess))
+		Expect(command.path).To(Equal([]string{"show", "interface"}))
+		Expect(command.arguments).To(Equal([]string{"eth0 extra"}))
+	})
+
+	It("Should treat operator arguments as operators", func() {
+		Expect(shell.Run([]string{"show", "config", "|", "include", "eth1"})).To(Equal(ExitSuccess))
+		Expect(stdout.String()).To(Equal("interface eth1\n"))
+	})
+
+	It("Should chain commands", func() {
+		Expect(shell.Run([]string{"fail", "||", "show", "config", "|", "include", "eth1"})).To(Equal(ExitSuccess))
+		Expect(stdout.String()).To(Equal("interface eth1\n"))
+		Expect(stderr.String()).To(Equal("exit 3\n"))
+	})
+
+	It("Should return the exit code for the command's error", func() {
+		Expect(shell.Run([]string{"fail"})).To(Equal(3))
+		Expect(stderr.String()).To(Equal("exit 3\n"))
+	})
+
+	It("Should return ExitTimeout when the command times out", func() {
+		shell.commands.Add("slow", slowCommand{})
+		shell.SetTimeout(time.Millisecond)
+		Expect(shell.Run([]string{"slow"})).To(Equal(ExitTimeout))
+		Expect(stderr.String()).To(Equal("slow: timed out after 1ms\n"))
+	})
+
+	It("Should return ExitUsage for an unknown command", func() {
+		Expect(shell.Run([]string{"bogus"})).To(Equal(ExitUsage))
+		Expect(stderr.String()).To(Equal("no matching command\n"))
+	})
+
+	It("Should list sub-commands when a tree is given without a leaf", func() {
+		Expect(shell.Run([]string{"show"})).To(Equal(ExitUsage))
+		Expect(stderr.String()).To(Equal("incomplete command\nusage: show <command> [arguments]\n\nAvailable commands:\n  config\n  interface\n"))
+	})
+
+	It("Should list the top level commands for --help", func() {
+		Expect(shell.Run([]string{"--help"})).To(Equal(ExitSuccess))
+		Expect(stdout.String()).To(Equal(`Available commands:
+  disable  Lower the privilege level
+  enable   Raise the privilege level
+  fail
+  fg       Display the output of a background job and wait for it
+  help     Display help for commands
+  jobs     List background jobs
+  kill     Stop a background job
+  show
+  source   Run each line of a file as a command
+`))
+	})
+
+	It("Should list sub-commands for --help", func() {
+		Expect(shell.Run([]string{"show", "--help"})).To(Equal(ExitSuccess))
+		Expect(stdout.String()).To(Equal("usage: show <command> [arguments]\n\nAvailable commands:\n  config\n  interface\n"))
+	})
+
+	It("Should print command usage for --help", func() {
+		Expect(shell.Run([]string{"show", "interface", "--help"})).To(Equal(ExitSuccess))
+		Expect(stdout.String()).To(Equal("usage: show interface [arguments]\n"))
+		Expect(command.executed).To(BeFalse())
+	})
+
+	It("Should start the interactive shell without arguments", func() {
+		prompt := newTestPrompt()
+		shell.SetPrompt(prompt)
+		prompt.lineEditor.addResponse("show interface", nil)
+		prompt.lineEditor.end()
+		Expect(shell.Run(nil)).To(Equal(ExitSuccess))
+		Expect(command.executed).To(BeTrue())
+	})
+})
@@ -0,0 +1,224 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Param declares a positional parameter accepted by a command
+//
+// Name identifies the parameter in error messages and in the Params of the
+// Invocation.  Type is the type the argument is converted to.  For an
+// IntValue, Min and Max limit the allowed values when Max is greater than
+// Min.  Optional parameters may be omitted and must follow every required
+// parameter
+type Param struct {
+	Name     string
+	Type     ValueType
+	Min      int
+	Max      int
+	Optional bool
+}
+
+// String returns the parameter in schema form, such as <mtu:int 68-9216> or
+// [detail:string]
+func (param Param) String() string {
+	if param.Optional {
+		return fmt.Sprintf("[%s:%s]", param.Name, param.expected())
+	}
+	return fmt.Sprintf("<%s:%s>", param.Name, param.expected())
+}
+
+// expected describes the values the parameter accepts
+func (param Param) expected() string {
+	if param.Type == IntValue && param.Max > param.Min {
+		return fmt.Sprintf("%v %d-%d", param.Type, param.Min, param.Max)
+	}
+	return param.Type.String()
+}
+
+// Parse converts an argument given for the parameter to the parameter's type.
+// An argument that cannot be converted or is out of range returns a
+// *ParamError
+func (param Param) Parse(arg string) (interface{}, error) {
+	value, err := param.Type.parse(arg)
+	if err == nil && param.Type == IntValue && param.Max > param.Min {
+		if i := value.(int); i < param.Min || i > param.Max {
+			err = ErrInvalidArgument
+		}
+	}
+
+	if err != nil {
+		return nil, &ParamError{Name: param.Name, Value: arg, Expected: param.expected(), Err: ErrInvalidArgument}
+	}
+	return value, nil
+}
+
+// ParamCommand is the interface for commands that declare their positional
+// parameters
+//
+// The arguments that remain after any flags are removed are validated and
+// converted before the command is executed.  The converted values are given
+// to the command in inv.Params while inv.Args continues to hold the
+// arguments as they were typed.  A command is never executed with missing,
+// invalid or unexpected arguments
+type ParamCommand interface {
+	Params() []Param
+}
+
+// commandParams returns the parameters declared by command
+func commandParams(command Command) []Param {
+	if pc, ok := command.(ParamCommand); ok {
+		return pc.Params()
+	}
+	return nil
+}
+
+// valueTypes maps the type names used in a schema to their ValueType
+var valueTypes = map[string]ValueType{
+	"string":   StringValue,
+	"bool":     BoolValue,
+	"int":      IntValue,
+	"duration": DurationValue,
+	"ip":       IPValue,
+}
+
+// ParseParams parses a schema of positional parameters
+//
+// Each parameter is written as <name:type> or, if it is optional, as
+// [name:type].  The type is one of string, bool, int, duration or ip and
+// defaults to string when it is omitted.  An int may be followed by the
+// range of values it allows, for instance:
+//
+//	<interface:string> <mtu:int 68-9216> [timeout:duration]
+func ParseParams(schema string) ([]Param, error) {
+	params := []Param{}
+	for rest := strings.TrimSpace(schema); rest != ""; rest = strings.TrimSpace(rest) {
+		closing := map[byte]string{'<': ">", '[': "]"}[rest[0]]
+		end := strings.Index(rest, closing)
+		if closing == "" || end < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidParamSchema, rest)
+		}
+
+		param, err := parseParam(rest[1:end])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidParamSchema, rest[:end+1])
+		}
+
+		param.Optional = rest[0] == '['
+		if !param.Optional && len(params) > 0 && params[len(params)-1].Optional {
+			return nil, fmt.Errorf("%w: %q follows an optional parameter", ErrInvalidParamSchema, rest[:end+1])
+		}
+		params = append(params, param)
+		rest = rest[end+1:]
+	}
+	return params, nil
+}
+
+// MustParseParams is like ParseParams but panics if the schema cannot be
+// parsed.  It simplifies declaring the parameters of a command in a global
+// variable
+func MustParseParams(schema string) []Param {
+	params, err := ParseParams(schema)
+	if err != nil {
+		panic(err)
+	}
+	return params
+}
+
+// parseParam parses the text between the brackets of a single parameter,
+// such as "mtu:int 68-9216"
+func parseParam(text string) (param Param, err error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields) > 2 {
+		return param, ErrInvalidParamSchema
+	}
+
+	typeName := "string"
+	param.Name = fields[0]
+	if i := strings.Index(fields[0], ":"); i >= 0 {
+		param.Name, typeName = fields[0][:i], fields[0][i+1:]
+	}
+
+	var found bool
+	if param.Type, found = valueTypes[typeName]; !found || param.Name == "" {
+		return param, ErrInvalidParamSchema
+	}
+
+	if len(fields) == 2 {
+		if param.Type != IntValue {
+			return param, ErrInvalidParamSchema
+		}
+		param.Min, param.Max, err = parseRange(fields[1])
+	}
+	return param, err
+}
+
+// parseRange parses an integer range such as 68-9216 or -10-10
+func parseRange(str string) (min, max int, err error) {
+	i := strings.Index(str[1:], "-") + 1
+	if i == 0 {
+		return 0, 0, ErrInvalidParamSchema
+	}
+
+	min, err = strconv.Atoi(str[:i])
+	if err == nil {
+		max, err = strconv.Atoi(str[i+1:])
+	}
+
+	if err != nil || max <= min {
+		return 0, 0, ErrInvalidParamSchema
+	}
+	return min, max, nil
+}
+
+// paramUsage returns the schema of the parameters, for use in usage messages
+func paramUsage(params []Param) string {
+	usage := make([]string, len(params))
+	for i, param := range params {
+		usage[i] = param.String()
+	}
+	return strings.Join(usage, " ")
+}
+
+// parseParams validates args against the parameters and converts them.  Only
+// the optional parameters that are given have values
+func parseParams(params []Param, args []string) (Values, error) {
+	values := Values{}
+	for i, param := range params {
+		if i >= len(args) {
+			if param.Optional {
+				break
+			}
+			return nil, &ParamError{Name: param.Name, Expected: param.expected(), Err: ErrMissingArgument}
+		}
+
+		value, err := param.Parse(args[i])
+		if err != nil {
+			return nil, err
+		}
+		values[param.Name] = value
+	}
+
+	if len(args) > len(params) {
+		return nil, &ParamError{Value: args[len(params)], Err: ErrUnexpectedArgument}
+	}
+	return values, nil
+}
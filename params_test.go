@@ -0,0 +1,170 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net"
+	"time"
+)
+
+// paramTestCommand is a test command that declares parameters
+type paramTestCommand struct {
+	testCommand
+	params []Param
+}
+
+func (p *paramTestCommand) Params() []Param {
+	return p.params
+}
+
+var _ = Describe("Params", func() {
+	Describe("ParseParams", func() {
+		It("Should parse names, types and ranges", func() {
+			params, err := ParseParams("<name> <mtu:int 68-9216> <addr:ip> [dur:duration]")
+			Expect(err).To(BeNil())
+			Expect(params).To(Equal([]Param{
+				{Name: "name", Type: StringValue},
+				{Name: "mtu", Type: IntValue, Min: 68, Max: 9216},
+				{Name: "addr", Type: IPValue},
+				{Name: "dur", Type: DurationValue, Optional: true},
+			}))
+			Expect(paramUsage(params)).To(Equal("<name:string> <mtu:int 68-9216> <addr:ip> [dur:duration]"))
+		})
+
+		It("Should parse negative ranges", func() {
+			params, err := ParseParams("<offset:int -10-10>")
+			Expect(err).To(BeNil())
+			Expect(params[0].Min).To(Equal(-10))
+			Expect(params[0].Max).To(Equal(10))
+		})
+
+		It("Should reject invalid schemas", func() {
+			for _, schema := range []string{
+				"<name",
+				"name",
+				"<name:float>",
+				"<:int>",
+				"<name:string 1-2>",
+				"<mtu:int 10-10>",
+				"[name] <mtu:int>",
+			} {
+				_, err := ParseParams(schema)
+				Expect(errors.Is(err, ErrInvalidParamSchema)).To(BeTrue(), schema)
+			}
+		})
+
+		It("Should panic in MustParseParams", func() {
+			Expect(func() { MustParseParams("<name:float>") }).To(Panic())
+		})
+	})
+
+	Describe("validation", func() {
+		params := MustParseParams("<name> <mtu:int 68-9216> <addr:ip> [dur:duration]")
+
+		It("Should convert the arguments", func() {
+			values, err := parseParams(params, []string{"eth0", "1500", "10.0.0.1", "5s"})
+			Expect(err).To(BeNil())
+			Expect(values.String("name")).To(Equal("eth0"))
+			Expect(values.Int("mtu")).To(Equal(1500))
+			Expect(values.IP("addr")).To(Equal(net.ParseIP("10.0.0.1")))
+			Expect(values.Duration("dur")).To(Equal(5 * time.Second))
+		})
+
+		It("Should allow optional parameters to be omitted", func() {
+			values, err := parseParams(params, []string{"eth0", "1500", "::1"})
+			Expect(err).To(BeNil())
+			Expect(values).NotTo(HaveKey("dur"))
+		})
+
+		It("Should name the parameter and its type in errors", func() {
+			tests := []struct {
+				args     []string
+				expected string
+			}{
+				{[]string{"eth0", "big"}, `invalid argument "big" for <mtu>: expected int 68-9216`},
+				{[]string{"eth0", "9217"}, `invalid argument "9217" for <mtu>: expected int 68-9216`},
+				{[]string{"eth0", "1500", "10.0.0"}, `invalid argument "10.0.0" for <addr>: expected ip`},
+				{[]string{"eth0", "1500"}, "missing argument <addr>: expected ip"},
+				{[]string{"eth0", "1500", "::1", "1s", "extra"}, `unexpected argument "extra"`},
+			}
+
+			for _, test := range tests {
+				_, err := parseParams(params, test.args)
+				Expect(err).To(MatchError(test.expected))
+			}
+		})
+	})
+
+	Describe("commands", func() {
+		var command *paramTestCommand
+		var shell *Shell
+		var stdout, stderr bytes.Buffer
+
+		BeforeEach(func() {
+			command = &paramTestCommand{params: MustParseParams("<name> <mtu:int 68-9216>")}
+			shell = NewShell(CommandMap{"mtu": command})
+			stdout.Reset()
+			stderr.Reset()
+			shell.SetOutputWriter(&stdout)
+			shell.SetErrorWriter(&stderr)
+		})
+
+		It("Should give the typed values to the command", func() {
+			Expect(shell.commandMap().Exec(context.Background(), &Invocation{Args: []string{"mtu", "eth0", "9000"}})).To(Succeed())
+			Expect(command.invocation.Params.Int("mtu")).To(Equal(9000))
+			Expect(command.arguments).To(Equal([]string{"eth0", "9000"}))
+		})
+
+		It("Should not execute the command with invalid arguments", func() {
+			err := shell.commandMap().Exec(context.Background(), &Invocation{Args: []string{"mtu", "eth0", "10"}})
+			Expect(err).To(MatchError(`mtu: invalid argument "10" for <mtu>: expected int 68-9216`))
+			Expect(command.executed).To(BeFalse())
+		})
+
+		It("Should validate the arguments that follow the flags", func() {
+			cmd := &flagParamCommand{paramTestCommand: paramTestCommand{params: MustParseParams("<count:int>")}}
+			cmd.flags = []Flag{{Name: "verbose", Type: BoolValue}}
+			Expect(CommandMap{"c": cmd}.Exec(context.Background(), &Invocation{Args: []string{"c", "--verbose", "3"}})).To(Succeed())
+			Expect(cmd.invocation.Params.Int("count")).To(Equal(3))
+		})
+
+		It("Should use the parameters as the usage", func() {
+			Expect(shell.Run([]string{"mtu", "--help"})).To(Equal(ExitSuccess))
+			Expect(stdout.String()).To(Equal("usage: mtu <name:string> <mtu:int 68-9216>\n"))
+		})
+
+		It("Should print the usage when one-shot arguments are invalid", func() {
+			Expect(shell.Run([]string{"mtu", "eth0"})).To(Equal(ExitUsage))
+			Expect(stderr.String()).To(Equal("mtu: missing argument <mtu>: expected int 68-9216\n\nusage: mtu <name:string> <mtu:int 68-9216>\n"))
+		})
+	})
+})
+
+// flagParamCommand declares both flags and parameters
+type flagParamCommand struct {
+	paramTestCommand
+	flags []Flag
+}
+
+func (f *flagParamCommand) Flags() []Flag {
+	return f.flags
+}
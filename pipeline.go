@@ -0,0 +1,134 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// pipeline is a list of stages where the output of each stage is connected
+// to the input of the next.  The first stage is a command and every following
+// stage is a filter.  If redirect is set then the output of the last stage is
+// written to that file, appending to it if appendOutput is set
+type pipeline struct {
+	stages       [][]string
+	redirect     string
+	appendOutput bool
+}
+
+// parsePipeline splits the tokens into pipeline stages at each pipe operator
+// and removes any trailing output redirection
+func parsePipeline(tokens []token) (*pipeline, error) {
+	p := &pipeline{}
+	var fields []string
+	for i, token := range tokens {
+		if token.kind == wordToken {
+			fields = append(fields, token.value)
+			continue
+		}
+
+		if len(fields) == 0 {
+			return nil, ErrEmptyPipelineStage
+		}
+
+		if token.value == redirectOperator || token.value == appendOperator {
+			/* redirection must be the end of the line */
+			if len(tokens) != i+2 || tokens[i+1].kind != wordToken {
+				return nil, ErrInvalidRedirect
+			}
+			p.redirect = tokens[i+1].value
+			p.appendOutput = token.value == appendOperator
+			break
+		}
+
+		if token.value != pipeOperator {
+			return nil, ErrMisplacedBackground
+		}
+
+		p.stages = append(p.stages, fields)
+		fields = nil
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrEmptyPipelineStage
+	}
+	p.stages = append(p.stages, fields)
+	return p, nil
+}
+
+// exec runs every stage of the pipeline concurrently and waits for all of
+// them to finish.  The options are used to find the command for every
+// stage.  The first stage reads from inv.Stdin and the last stage writes to
+// inv.Stdout.  The first error returned by a stage is returned, except for
+// io.ErrClosedPipe which only indicates that a later stage stopped reading
+// early
+func (p *pipeline) exec(ctx context.Context, commands, filters CommandMap, inv *Invocation, options ...FindOption) error {
+	if len(p.stages) == 1 {
+		call := *inv
+		call.Args = p.stages[0]
+		return commands.Exec(ctx, &call, options...)
+	}
+
+	errs := make([]error, len(p.stages))
+	var wg sync.WaitGroup
+	var previous *io.PipeReader
+	for i, fields := range p.stages {
+		call := *inv
+		call.Args = fields
+		stageCommands := commands
+		if i > 0 {
+			call.Stdin = previous
+			stageCommands = filters
+		}
+
+		var next *io.PipeReader
+		var pw *io.PipeWriter
+		if i < len(p.stages)-1 {
+			next, pw = io.Pipe()
+			call.Stdout = pw
+		}
+
+		wg.Add(1)
+		go func(i int, stageCommands CommandMap, call *Invocation, pr *io.PipeReader, pw *io.PipeWriter) {
+			defer wg.Done()
+			errs[i] = stageCommands.Exec(ctx, call, options...)
+
+			/* let the next stage see the end of its input
+			 * and unblock any writes from the previous stage
+			 */
+			if pw != nil {
+				pw.Close()
+			}
+
+			if pr != nil {
+				pr.Close()
+			}
+		}(i, stageCommands, &call, previous, pw)
+		previous = next
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return err
+		}
+	}
+	return nil
+}
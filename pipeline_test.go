@@ -0,0 +1,142 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func parseLine(line string) (*pipeline, error) {
+	tokens, err := lex(line, shellOperators)
+	if err != nil {
+		return nil, err
+	}
+	return parsePipeline(tokens)
+}
+
+func outputCommand(output string) Command {
+	return CommandFunc(func(ctx context.Context, inv *Invocation) error {
+		_, err := fmt.Fprint(inv.Stdout, output)
+		return err
+	})
+}
+
+var _ = Describe("pipeline", func() {
+	Describe("parsing", func() {
+		It("Should split the line into stages", func() {
+			p, err := parseLine("show config | include eth | count")
+			Expect(err).To(BeNil())
+			Expect(p.stages).To(Equal([][]string{{"show", "config"}, {"include", "eth"}, {"count"}}))
+		})
+
+		It("Should not split on quoted pipes", func() {
+			p, err := parseLine(`show config | include "eth0|eth1"`)
+			Expect(err).To(BeNil())
+			Expect(p.stages).To(Equal([][]string{{"show", "config"}, {"include", "eth0|eth1"}}))
+		})
+
+		It("Should remove a trailing redirection", func() {
+			p, err := parseLine("show config | include eth > out.txt")
+			Expect(err).To(BeNil())
+			Expect(p.stages).To(Equal([][]string{{"show", "config"}, {"include", "eth"}}))
+			Expect(p.redirect).To(Equal("out.txt"))
+			Expect(p.appendOutput).To(BeFalse())
+		})
+
+		It("Should recognize an appending redirection", func() {
+			p, err := parseLine("show time>>out.txt")
+			Expect(err).To(BeNil())
+			Expect(p.stages).To(Equal([][]string{{"show", "time"}}))
+			Expect(p.redirect).To(Equal("out.txt"))
+			Expect(p.appendOutput).To(BeTrue())
+		})
+
+		It("Should require exactly one file name after a redirection", func() {
+			for _, line := range []string{"show >", "show > a b", "show > a | count", "show > a > b"} {
+				_, err := parseLine(line)
+				Expect(err).To(MatchError(ErrInvalidRedirect))
+			}
+		})
+
+		It("Should return an error for an empty stage", func() {
+			for _, line := range []string{"| include eth", "show |", "show | | count"} {
+				_, err := parseLine(line)
+				Expect(err).To(MatchError(ErrEmptyPipelineStage))
+			}
+		})
+	})
+
+	Describe("exec", func() {
+		var commands CommandMap
+		var stdout *bytes.Buffer
+		var inv *Invocation
+
+		BeforeEach(func() {
+			commands = CommandMap{
+				"show": outputCommand(testConfig),
+			}
+			stdout = &bytes.Buffer{}
+			inv = &Invocation{Stdout: stdout}
+		})
+
+		It("Should connect the output of each stage to the input of the next", func() {
+			p, _ := parseLine("show | include interface | count")
+			Expect(p.exec(context.Background(), commands, DefaultFilters(), inv)).To(Succeed())
+			Expect(stdout.String()).To(Equal("Count: 2 lines\n"))
+		})
+
+		It("Should only look up filters after a pipe", func() {
+			p, _ := parseLine("show | show")
+			Expect(p.exec(context.Background(), commands, DefaultFilters(), inv)).To(MatchError(ErrNoMatchingCommand))
+		})
+
+		It("Should return the error from a failed stage", func() {
+			commands["fail"] = CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				return errors.New("failed")
+			})
+			p, _ := parseLine("fail | count")
+			Expect(p.exec(context.Background(), commands, DefaultFilters(), inv)).To(MatchError("failed"))
+			Expect(stdout.String()).To(Equal("Count: 0 lines\n"))
+		})
+
+		It("Should not block a command when a filter stops reading", func() {
+			commands["yes"] = CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				for {
+					if _, err := fmt.Fprintln(inv.Stdout, "y"); err != nil {
+						return err
+					}
+				}
+			})
+			filters := CommandMap{
+				"head": CommandFunc(func(ctx context.Context, inv *Invocation) error {
+					buf := make([]byte, 2)
+					inv.Stdin.Read(buf)
+					_, err := inv.Stdout.Write(buf)
+					return err
+				}),
+			}
+			p, _ := parseLine("yes | head")
+			Expect(p.exec(context.Background(), commands, filters, inv)).To(Succeed())
+			Expect(stdout.String()).To(Equal("y\n"))
+		})
+	})
+})
@@ -0,0 +1,230 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+)
+
+const (
+	// DefaultPrivilege is the privilege level of a new Shell and the level
+	// that disable returns to
+	DefaultPrivilege = 1
+
+	// MaxPrivilege is the highest privilege level and the level that enable
+	// raises the Shell to when no level is given
+	MaxPrivilege = 15
+)
+
+// Privileges are the privileges of the user of a Shell
+//
+// User is the name of the user, if it is known.  Level is the privilege
+// level, from 0 to MaxPrivilege, and Roles are the names of the roles that
+// the user holds, such as "operator" or "network-admin"
+type Privileges struct {
+	User  string
+	Level int
+	Roles []string
+}
+
+// HasRole reports whether the user holds the role
+func (p Privileges) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// PrivilegedCommand is the interface for commands that require a minimum
+// privilege level
+//
+// Commands above the Shell's privilege level are not completed or listed by
+// help and executing them fails with a *PermissionError.  A TreeCommand's
+// level, set with WithPrivilege, also applies to its sub-commands.  Commands
+// that do not implement PrivilegedCommand may be executed at any level
+type PrivilegedCommand interface {
+	Privilege() int
+}
+
+// RoleCommand is the interface for commands that may only be executed by
+// users holding one of the Roles.  Like commands above the Shell's privilege
+// level, the command is hidden from users without one of the roles.  A
+// command without any roles is not restricted
+type RoleCommand interface {
+	Roles() []string
+}
+
+// Authenticator checks the password given to enable.  It is called with the
+// current privileges and the level being requested and should return
+// ErrAuthenticationFailed if the password is not accepted
+type Authenticator func(privileges Privileges, level int, password string) error
+
+// Authorizer decides whether the user may use the command at path.  It is
+// called for every command along a path, so that vetoing "configure" also
+// vetoes "configure terminal".  A non-nil error vetoes the command, which is
+// then hidden and fails with a *PermissionError that wraps the error
+type Authorizer func(privileges Privileges, path []string) error
+
+// Privileges returns the privileges of the Shell's user
+func (shell *Shell) Privileges() Privileges {
+	shell.privilegeLock.Lock()
+	defer shell.privilegeLock.Unlock()
+	return shell.privileges
+}
+
+// SetPrivileges sets the privileges of the Shell's user.  A new Shell has no
+// user or roles and is at DefaultPrivilege.  Any mode entered with a command
+// that the new privileges do not permit is left
+func (shell *Shell) SetPrivileges(privileges Privileges) {
+	shell.privilegeLock.Lock()
+	shell.privileges = privileges
+	shell.privilegeLock.Unlock()
+	shell.leaveForbiddenModes()
+}
+
+// SetAuthenticator sets the function that checks the password given to
+// enable.  Until an Authenticator is set, enable can only lower the
+// privilege level.  A nil authenticator generates the ErrNilCallback error
+func (shell *Shell) SetAuthenticator(authenticator Authenticator) error {
+	if authenticator == nil {
+		return ErrNilCallback
+	}
+	shell.privilegeLock.Lock()
+	shell.authenticator = authenticator
+	shell.privilegeLock.Unlock()
+	return nil
+}
+
+// SetAuthorizer sets the function that may veto any command path, in
+// addition to the privilege levels and roles that commands declare.  A nil
+// authorizer generates the ErrNilCallback error
+func (shell *Shell) SetAuthorizer(authorizer Authorizer) error {
+	if authorizer == nil {
+		return ErrNilCallback
+	}
+	shell.privilegeLock.Lock()
+	shell.authorizer = authorizer
+	shell.privilegeLock.Unlock()
+	shell.leaveForbiddenModes()
+	return nil
+}
+
+// authorize returns a *PermissionError if the command at path may not be
+// used with the Shell's privileges
+func (shell *Shell) authorize(path []string, command Command) error {
+	shell.privilegeLock.Lock()
+	privileges := shell.privileges
+	authorizer := shell.authorizer
+	shell.privilegeLock.Unlock()
+
+	if pc, ok := command.(PrivilegedCommand); ok && pc.Privilege() > privileges.Level {
+		return &PermissionError{Path: path}
+	}
+
+	if rc, ok := command.(RoleCommand); ok && len(rc.Roles()) > 0 {
+		permitted := false
+		for _, role := range rc.Roles() {
+			permitted = permitted || privileges.HasRole(role)
+		}
+		if !permitted {
+			return &PermissionError{Path: path}
+		}
+	}
+
+	if authorizer != nil {
+		if err := authorizer(privileges, append([]string(nil), path...)); err != nil {
+			return &PermissionError{Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+// enable raises the privilege level after the Authenticator accepts the
+// user's password.  Lowering the level does not require a password
+func (shell *Shell) enable(level int) error {
+	privileges := shell.Privileges()
+	if level > privileges.Level {
+		shell.privilegeLock.Lock()
+		authenticator := shell.authenticator
+		shell.privilegeLock.Unlock()
+		if authenticator == nil {
+			return ErrAuthenticationFailed
+		}
+
+		prompt, ok := shell.prompt.(PasswordPrompt)
+		if !ok {
+			return ErrNoPasswordPrompt
+		}
+
+		password, err := prompt.PromptPassword("Password: ")
+		if err != nil {
+			return err
+		} else if err := authenticator(privileges, level, password); err != nil {
+			return err
+		}
+	}
+
+	privileges.Level = level
+	shell.SetPrivileges(privileges)
+	return nil
+}
+
+// privilegeLevel returns the level given as the only argument of enable or
+// disable, or level if there are no arguments
+func privilegeLevel(inv *Invocation, level int) (int, error) {
+	values, err := parseParams([]Param{{Name: "level", Type: IntValue, Min: 0, Max: MaxPrivilege, Optional: true}}, inv.Args)
+	if err != nil {
+		err.(*ParamError).Path = inv.Path
+		return 0, err
+	} else if _, found := values["level"]; found {
+		level = values.Int("level")
+	}
+	return level, nil
+}
+
+// enableCommand raises the privilege level, to MaxPrivilege by default
+func enableCommand(ctx context.Context, inv *Invocation) error {
+	if inv.Shell == nil {
+		return ErrNoShell
+	}
+
+	level, err := privilegeLevel(inv, MaxPrivilege)
+	if err != nil {
+		return err
+	}
+	return inv.Shell.enable(level)
+}
+
+// disableCommand lowers the privilege level, to DefaultPrivilege by default
+func disableCommand(ctx context.Context, inv *Invocation) error {
+	if inv.Shell == nil {
+		return ErrNoShell
+	}
+
+	level, err := privilegeLevel(inv, DefaultPrivilege)
+	if err != nil {
+		return err
+	}
+
+	if privileges := inv.Shell.Privileges(); level < privileges.Level {
+		privileges.Level = level
+		inv.Shell.SetPrivileges(privileges)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// privilegedCommand is a testCommand that requires a privilege level and,
+// optionally, one of a set of roles
+type privilegedCommand struct {
+	*testCommand
+	level int
+	roles []string
+}
+
+func (p privilegedCommand) Privilege() int {
+	return p.level
+}
+
+func (p privilegedCommand) Roles() []string {
+	return p.roles
+}
+
+// passwordEditor is a line editor that returns passwords in order
+type passwordEditor struct {
+	passwords []string
+	prompts   []string
+}
+
+func (p *passwordEditor) Prompt(string) (string, error) {
+	return "", nil
+}
+
+func (p *passwordEditor) PromptPassword(prompt string) (string, error) {
+	p.prompts = append(p.prompts, prompt)
+	password := p.passwords[0]
+	p.passwords = p.passwords[1:]
+	return password, nil
+}
+
+var _ = Describe("Privileges", func() {
+	var shell *Shell
+	var reload, debug *testCommand
+	var stdout, stderr bytes.Buffer
+	var editor *passwordEditor
+
+	run := func(line string) error {
+		return shell.execLine(context.Background(), shell.invocation(), line)
+	}
+
+	complete := func(line string) []string {
+		_, completions, _ := shell.completer.complete(line, len(line))
+		return completions
+	}
+
+	BeforeEach(func() {
+		reload = newTestCommand()
+		debug = newTestCommand()
+		shell = NewShell(CommandMap{
+			"reload": privilegedCommand{testCommand: reload, level: MaxPrivilege},
+			"show":   newTestCommand(),
+			"debug": NewTreeCommand(CommandMap{
+				"trace": privilegedCommand{testCommand: debug, roles: []string{"developer"}},
+			}).WithPrivilege(5),
+		})
+		for _, name := range []string{"fg", "jobs", "kill", "source"} {
+			delete(shell.Builtins(), name)
+		}
+		editor = &passwordEditor{}
+		shell.prompt.(*DefaultPrompt).SetLineEditor(editor)
+		stdout.Reset()
+		stderr.Reset()
+		shell.SetOutputWriter(&stdout)
+		shell.SetErrorWriter(&stderr)
+	})
+
+	It("Should start at the default privilege level", func() {
+		Expect(shell.Privileges()).To(Equal(Privileges{Level: DefaultPrivilege}))
+	})
+
+	It("Should hide commands above the privilege level", func() {
+		Expect(complete("")).To(Equal([]string{"disable", "enable", "help", "show"}))
+		Expect(complete("debug ")).To(BeEmpty())
+		Expect(run("help")).To(Succeed())
+		Expect(stdout.String()).NotTo(ContainSubstring("reload"))
+
+		err := run("reload")
+		Expect(err).To(MatchError(ErrPermissionDenied))
+		Expect(err.Error()).To(Equal("reload: permission denied"))
+		Expect(run("debug trace")).To(MatchError(ErrPermissionDenied))
+		Expect(run("help reload")).To(MatchError(ErrPermissionDenied))
+		Expect(reload.executed).To(BeFalse())
+	})
+
+	It("Should not consider hidden commands when expanding an abbreviation", func() {
+		shutdown := newTestCommand()
+		shell.commands["shutdown"] = privilegedCommand{testCommand: shutdown, level: MaxPrivilege}
+		shell.SetAbbreviations(true)
+		shell.SetPrivileges(Privileges{Level: 1})
+
+		Expect(run("sh")).To(Succeed())
+		Expect(shell.commands["show"].(*testCommand).executed).To(BeTrue())
+		Expect(run("re")).To(MatchError(ErrNoMatchingCommand))
+
+		shell.SetPrivileges(Privileges{Level: MaxPrivilege})
+		err := run("sh")
+		Expect(err).To(BeAssignableToTypeOf(&AmbiguousCommandError{}))
+		Expect(err.(*AmbiguousCommandError).Candidates).To(Equal([]string{"show", "shutdown"}))
+		Expect(shutdown.executed).To(BeFalse())
+	})
+
+	It("Should require one of the roles of a command", func() {
+		shell.SetPrivileges(Privileges{User: "alice", Level: 5})
+		Expect(complete("debug ")).To(BeEmpty())
+		Expect(run("debug trace")).To(MatchError(ErrPermissionDenied))
+
+		shell.SetPrivileges(Privileges{User: "alice", Level: 5, Roles: []string{"operator", "developer"}})
+		Expect(complete("debug ")).To(Equal([]string{"trace"}))
+		Expect(run("debug trace")).To(Succeed())
+		Expect(debug.executed).To(BeTrue())
+	})
+
+	It("Should raise the level after authenticating", func() {
+		var requested []int
+		Expect(shell.SetAuthenticator(nil)).To(MatchError(ErrNilCallback))
+		Expect(shell.SetAuthenticator(func(privileges Privileges, level int, password string) error {
+			requested = append(requested, level)
+			if password != "s3cret" {
+				return ErrAuthenticationFailed
+			}
+			return nil
+		})).To(Succeed())
+
+		editor.passwords = []string{"wrong", "s3cret"}
+		Expect(run("enable")).To(MatchError(ErrAuthenticationFailed))
+		Expect(shell.Privileges().Level).To(Equal(DefaultPrivilege))
+
+		Expect(run("enable")).To(Succeed())
+		Expect(editor.prompts).To(Equal([]string{"Password: ", "Password: "}))
+		Expect(requested).To(Equal([]int{MaxPrivilege, MaxPrivilege}))
+		Expect(shell.Privileges().Level).To(Equal(MaxPrivilege))
+		Expect(complete("re")).To(Equal([]string{"reload"}))
+		Expect(run("reload")).To(Succeed())
+
+		Expect(run("enable 5")).To(Succeed())
+		Expect(shell.Privileges().Level).To(Equal(5))
+		Expect(run("disable")).To(Succeed())
+		Expect(shell.Privileges().Level).To(Equal(DefaultPrivilege))
+		Expect(editor.passwords).To(BeEmpty())
+	})
+
+	It("Should not raise the level without an authenticator", func() {
+		Expect(run("enable")).To(MatchError(ErrAuthenticationFailed))
+		Expect(run("enable 0")).To(Succeed())
+		Expect(shell.Privileges().Level).To(Equal(0))
+		Expect(run("enable 16")).To(MatchError(ErrInvalidArgument))
+		Expect(run("disable 1 2")).To(MatchError(ErrUnexpectedArgument))
+	})
+
+	It("Should let the authorizer veto any command path", func() {
+		denied := errors.New("outside of the maintenance window")
+		Expect(shell.SetAuthorizer(nil)).To(MatchError(ErrNilCallback))
+		Expect(shell.SetAuthorizer(func(privileges Privileges, path []string) error {
+			if strings.Join(path, " ") == "show" {
+				return denied
+			}
+			return nil
+		})).To(Succeed())
+
+		Expect(complete("")).To(Equal([]string{"disable", "enable", "help"}))
+		err := run("show")
+		Expect(errors.Is(err, ErrPermissionDenied)).To(BeTrue())
+		Expect(errors.Is(err, denied)).To(BeTrue())
+		Expect(err.Error()).To(Equal("show: permission denied: outside of the maintenance window"))
+	})
+})
@@ -34,6 +34,15 @@ type Prompt interface {
 	NextResponse() (string, error)
 }
 
+// PasswordPrompt is implemented by prompts and line editors that can read a
+// password without displaying it
+//
+// PromptPassword displays the prompt and returns the password that was
+// entered.  The password is never added to the history
+type PasswordPrompt interface {
+	PromptPassword(prompt string) (string, error)
+}
+
 // Prompter returns the prompt string used in NextResponse
 //
 // Prompter is a function that is called to generate the prompt string that
@@ -56,11 +65,15 @@ type DefaultPrompt struct {
 // When NextResponse is called on the DefaultPrompt the prompt will be "> ".
 // The DefaultLineEditor is used so tab completions and history is available
 func NewDefaultPrompt(commands CommandMap) *DefaultPrompt {
+	return newDefaultPrompt(NewDefaultLineEditor(commands))
+}
+
+func newDefaultPrompt(lineEditor LineEditor) *DefaultPrompt {
 	p := DefaultPrompt{
 		func() string {
 			return "> "
 		},
-		NewDefaultLineEditor(commands),
+		lineEditor,
 	}
 	return &p
 }
@@ -80,7 +93,7 @@ func (p *DefaultPrompt) SetPrompter(prompter func() string) error {
 
 // SetLineEditor allows overriding the default line editor
 //
-// The DefaultPrompt uses github.com/peterh/liner as the default line editor.
+// The DefaultPrompt uses the DefaultLineEditor as the default line editor.
 // This can be overridden with a different LineEditor implementation.  If
 // SetLineEditor is called with a nil LineEditor then the ErrNilLineEditor
 // error is returned
@@ -97,6 +110,15 @@ func (p *DefaultPrompt) NextResponse() (string, error) {
 	return p.lineEditor.Prompt(p.prompter())
 }
 
+// PromptPassword reads a password with the line editor.  ErrNoPasswordPrompt
+// is returned if the line editor does not implement PasswordPrompt
+func (p *DefaultPrompt) PromptPassword(prompt string) (string, error) {
+	if lineEditor, ok := p.lineEditor.(PasswordPrompt); ok {
+		return lineEditor.PromptPassword(prompt)
+	}
+	return "", ErrNoPasswordPrompt
+}
+
 // Close closes the line editor (if it is closeable)
 func (p *DefaultPrompt) Close() error {
 	if lineEditor, ok := p.lineEditor.(Closeable); ok {
@@ -0,0 +1,235 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DefaultCompletionTimeout is how long the completer waits for a command to
+// provide its completion candidates
+const DefaultCompletionTimeout = 500 * time.Millisecond
+
+// CompletionResults collects the candidates provided by an AsyncCompletable.
+// It is safe for concurrent use
+type CompletionResults struct {
+	lock       sync.Mutex
+	candidates []Candidate
+}
+
+// Add appends candidates to the results.  Candidates that have been added
+// are displayed even if the provider does not finish in time
+func (r *CompletionResults) Add(candidates ...Candidate) {
+	r.lock.Lock()
+	r.candidates = append(r.candidates, candidates...)
+	r.lock.Unlock()
+}
+
+// list returns a copy of the candidates added so far
+func (r *CompletionResults) list() []Candidate {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Candidate(nil), r.candidates...)
+}
+
+// AsyncCompletable is the interface for commands that take a long time to
+// provide their completion candidates, such as those that query a backend
+//
+// CompleteAsync adds candidates to results as they become available.  The
+// context is cancelled once the Shell's completion timeout expires, at which
+// point the candidates added so far are displayed as partial results.
+// CompleteAsync returns nil once every candidate has been added, or the
+// context's error if it stopped early.  A command that implements
+// AsyncCompletable is completed with CompleteAsync rather than with any of
+// the other completion interfaces
+type AsyncCompletable interface {
+	CompleteAsync(ctx context.Context, request *CompletionRequest, results *CompletionResults) error
+}
+
+// CachedCompletable is the interface for commands whose completion candidates
+// can be reused
+//
+// CompletionTTL returns how long the candidates remain fresh.  Candidates are
+// cached for each command path and list of preceding arguments and are
+// reused for any partial word, so a CachedCompletable should provide every
+// candidate for the argument rather than only those matching the Word.  Once
+// the candidates expire they are provided again, and if that does not finish
+// within the completion timeout then the expired candidates are displayed
+type CachedCompletable interface {
+	CompletionTTL() time.Duration
+}
+
+// providerFunc provides the completion candidates for a request
+type providerFunc func(ctx context.Context, request *CompletionRequest, results *CompletionResults) error
+
+// completionProvider returns the function that provides the completion
+// candidates for command, or nil if command is not completable
+func completionProvider(command Command) providerFunc {
+	switch completable := command.(type) {
+	case AsyncCompletable:
+		return completable.CompleteAsync
+	case CandidateCompletable:
+		return func(ctx context.Context, request *CompletionRequest, results *CompletionResults) error {
+			results.Add(completable.Candidates(request)...)
+			return nil
+		}
+	case ArgumentCompletable:
+		return func(ctx context.Context, request *CompletionRequest, results *CompletionResults) error {
+			results.Add(stringCandidates(completable.CompleteArgument(request))...)
+			return nil
+		}
+	case Completable:
+		return func(ctx context.Context, request *CompletionRequest, results *CompletionResults) error {
+			results.Add(stringCandidates(completable.Completions(request.Word))...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// completionTTL returns how long the candidates of command may be cached
+func completionTTL(command Command) time.Duration {
+	if cached, ok := command.(CachedCompletable); ok {
+		return cached.CompletionTTL()
+	}
+	return 0
+}
+
+// pendingCompletion is a provider that is still running
+type pendingCompletion struct {
+	done    chan struct{}
+	results CompletionResults
+	err     error
+}
+
+// cachedCompletion holds the candidates of a provider that finished
+type cachedCompletion struct {
+	candidates []Candidate
+	expires    time.Time
+}
+
+// completionCache runs completion providers and caches their candidates.
+// Only one provider runs at a time for each request, so pressing Tab while a
+// slow provider is running waits for it rather than starting another
+type completionCache struct {
+	lock    sync.Mutex
+	entries map[string]cachedCompletion
+	pending map[string]*pendingCompletion
+	now     func() time.Time
+}
+
+func newCompletionCache() *completionCache {
+	return &completionCache{
+		entries: make(map[string]cachedCompletion),
+		pending: make(map[string]*pendingCompletion),
+		now:     time.Now,
+	}
+}
+
+// provide returns the candidates that command provides for the request in
+// mode, which is nil outside of any mode.  It waits no longer than timeout,
+// or indefinitely if the timeout is zero.  The returned flag is set when the
+// candidates are partial or have expired
+func (cache *completionCache) provide(mode *Mode, command Command, provider providerFunc, request *CompletionRequest, timeout time.Duration) ([]Candidate, bool) {
+	key := fmt.Sprintf("%p %s %q %q", mode, commandKey(command), request.Path, request.Args)
+	ttl := completionTTL(command)
+
+	cache.lock.Lock()
+	entry, cached := cache.entries[key]
+	if cached && cache.now().Before(entry.expires) {
+		cache.lock.Unlock()
+		return entry.candidates, false
+	}
+
+	p := cache.pending[key]
+	if p == nil {
+		p = cache.start(key, provider, request, timeout, ttl)
+	}
+	cache.lock.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-p.done:
+		return p.results.list(), p.err != nil
+	case <-expired:
+	}
+
+	if cached {
+		return entry.candidates, true
+	}
+	return p.results.list(), true
+}
+
+// start runs the provider in the background.  The candidates are cached once
+// it finishes successfully, even if provide has stopped waiting for it.  The
+// cache must be locked when start is called
+func (cache *completionCache) start(key string, provider providerFunc, request *CompletionRequest, timeout, ttl time.Duration) *pendingCompletion {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	p := &pendingCompletion{done: make(chan struct{})}
+	cache.pending[key] = p
+	go func() {
+		defer cancel()
+		err := provider(ctx, request, &p.results)
+
+		cache.lock.Lock()
+		delete(cache.pending, key)
+		if err == nil && ttl > 0 {
+			cache.evict()
+			cache.entries[key] = cachedCompletion{candidates: p.results.list(), expires: cache.now().Add(ttl)}
+		}
+		cache.lock.Unlock()
+
+		p.err = err
+		close(p.done)
+	}()
+	return p
+}
+
+// evict removes the entries that have expired.  The cache must be locked when
+// evict is called
+func (cache *completionCache) evict() {
+	now := cache.now()
+	for key, entry := range cache.entries {
+		if !now.Before(entry.expires) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// commandKey identifies command in the cache by its address or, for commands
+// that have none, by their type and value
+func commandKey(command Command) string {
+	switch reflect.ValueOf(command).Kind() {
+	case reflect.Ptr, reflect.Func, reflect.Map, reflect.Chan, reflect.Slice:
+		return fmt.Sprintf("%T %p", command, command)
+	}
+	return fmt.Sprintf("%T %v", command, command)
+}
@@ -0,0 +1,213 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sync"
+	"time"
+)
+
+// asyncCommand provides its first candidate immediately and the rest once
+// it is released
+type asyncCommand struct {
+	testCommand
+	lock      sync.Mutex
+	calls     int
+	cancelled bool
+	release   chan struct{}
+	ttl       time.Duration
+}
+
+func (a *asyncCommand) CompleteAsync(ctx context.Context, request *CompletionRequest, results *CompletionResults) error {
+	a.lock.Lock()
+	a.calls++
+	release := a.release
+	a.lock.Unlock()
+
+	results.Add(Candidate{Value: "eth0"})
+	select {
+	case <-release:
+		results.Add(Candidate{Value: "eth1"})
+		return nil
+	case <-ctx.Done():
+		a.lock.Lock()
+		a.cancelled = true
+		a.lock.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (a *asyncCommand) CompletionTTL() time.Duration {
+	return a.ttl
+}
+
+func (a *asyncCommand) callCount() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.calls
+}
+
+// slowCompletable is a Completable that blocks until it is released
+type slowCompletable struct {
+	testCommand
+	release chan struct{}
+}
+
+func (s *slowCompletable) Completions(field string) []string {
+	<-s.release
+	return []string{"eth0", "eth1"}
+}
+
+func (s *slowCompletable) CompletionTTL() time.Duration {
+	return time.Minute
+}
+
+var _ = Describe("completion providers", func() {
+	var c *completer
+	var async *asyncCommand
+	var slow *slowCompletable
+	var now time.Time
+
+	values := func(line string) ([]string, bool) {
+		result := c.completeLine(line, len(line))
+		values := []string{}
+		for _, candidate := range result.candidates {
+			values = append(values, candidate.Value)
+		}
+		return values, result.incomplete
+	}
+
+	BeforeEach(func() {
+		async = &asyncCommand{release: make(chan struct{}), ttl: time.Minute}
+		slow = &slowCompletable{release: make(chan struct{})}
+		c = newCompleter(CommandMap{"async": async, "slow": slow})
+		c.timeout = 20 * time.Millisecond
+		now = time.Now()
+		c.cache.now = func() time.Time { return now }
+	})
+
+	It("Should display partial results and cancel the provider when the timeout expires", func() {
+		candidates, incomplete := values("async ")
+		Expect(candidates).To(Equal([]string{"eth0"}))
+		Expect(incomplete).To(BeTrue())
+		Eventually(func() bool {
+			async.lock.Lock()
+			defer async.lock.Unlock()
+			return async.cancelled
+		}).Should(BeTrue())
+	})
+
+	It("Should cache the results for the provider's TTL", func() {
+		close(async.release)
+		candidates, incomplete := values("async ")
+		Expect(candidates).To(Equal([]string{"eth0", "eth1"}))
+		Expect(incomplete).To(BeFalse())
+
+		candidates, _ = values("async e")
+		Expect(candidates).To(Equal([]string{"eth0", "eth1"}))
+		Expect(async.callCount()).To(Equal(1))
+
+		values("async x ")
+		Expect(async.callCount()).To(Equal(2))
+
+		now = now.Add(time.Minute)
+		values("async ")
+		Expect(async.callCount()).To(Equal(3))
+	})
+
+	It("Should cache the results of each command and mode separately", func() {
+		close(async.release)
+		values("async ")
+
+		other := &asyncCommand{release: async.release, ttl: time.Minute}
+		c.topLevelCommands = CommandMap{"async": other}
+		values("async ")
+		Expect(other.callCount()).To(Equal(1))
+
+		c.topLevelCommands = CommandMap{"async": async}
+		c.mode = &Mode{Name: "config"}
+		values("async ")
+		Expect(async.callCount()).To(Equal(2))
+	})
+
+	It("Should evict expired results", func() {
+		close(async.release)
+		values("async ")
+		values("async x ")
+		Expect(c.cache.entries).To(HaveLen(2))
+
+		now = now.Add(time.Minute)
+		values("async ")
+		Expect(c.cache.entries).To(HaveLen(1))
+	})
+
+	It("Should display expired results when the provider is slow", func() {
+		close(async.release)
+		values("async ")
+
+		async.lock.Lock()
+		async.release = make(chan struct{})
+		async.lock.Unlock()
+		now = now.Add(time.Minute)
+
+		candidates, incomplete := values("async ")
+		Expect(candidates).To(Equal([]string{"eth0", "eth1"}))
+		Expect(incomplete).To(BeTrue())
+		Expect(async.callCount()).To(Equal(2))
+	})
+
+	It("Should not wait for slow Completions and cache them once they finish", func() {
+		candidates, incomplete := values("slow ")
+		Expect(candidates).To(BeEmpty())
+		Expect(incomplete).To(BeTrue())
+
+		close(slow.release)
+		Eventually(func() []string {
+			candidates, _ := values("slow ")
+			return candidates
+		}).Should(Equal([]string{"eth0", "eth1"}))
+
+		_, incomplete = values("slow ")
+		Expect(incomplete).To(BeFalse())
+	})
+
+	It("Should only run one provider at a time for each request", func() {
+		c.timeout = 0
+		done := make(chan []string, 2)
+		complete := func() {
+			candidates, _ := values("async ")
+			done <- candidates
+		}
+
+		go complete()
+		Eventually(async.callCount).Should(Equal(1))
+		go complete()
+		Consistently(done).ShouldNot(Receive())
+
+		close(async.release)
+		Eventually(done).Should(Receive(Equal([]string{"eth0", "eth1"})))
+		Eventually(done).Should(Receive(Equal([]string{"eth0", "eth1"})))
+		Expect(async.callCount()).To(Equal(1))
+	})
+
+	It("Should note incomplete results in the context help", func() {
+		Expect(c.contextHelp("async ", 6)).To(Equal("  eth0\n  <cr>\n" + incompleteNotice))
+	})
+})
@@ -0,0 +1,148 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RedirectPolicy decides whether command output may be written to a file
+//
+// The policy is called with the file name given on the command line and
+// whether the output will be appended to the file.  It returns the path of
+// the file that should actually be opened, or an error to deny the
+// redirection.  Returning a different path allows a policy to confine
+// relative names to a particular directory
+type RedirectPolicy func(name string, appendOutput bool) (string, error)
+
+// denyRedirects is the default RedirectPolicy of a Shell
+func denyRedirects(name string, appendOutput bool) (string, error) {
+	return "", ErrRedirectDenied
+}
+
+// AllowRedirects is a RedirectPolicy that permits writing to any file
+func AllowRedirects(name string, appendOutput bool) (string, error) {
+	return name, nil
+}
+
+// RedirectWithin returns a RedirectPolicy that only permits writing to files
+// within dir.  Relative names are resolved relative to dir and any name that
+// would resolve to a file outside of dir, including through a symbolic link,
+// is denied with ErrRedirectDenied
+func RedirectWithin(dir string) RedirectPolicy {
+	return func(name string, appendOutput bool) (string, error) {
+		root, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+
+		root, err = resolveLinks(root)
+		if err != nil {
+			return "", err
+		}
+
+		path, err = resolveLinks(filepath.Clean(path))
+		if err != nil {
+			return "", err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", ErrRedirectDenied
+		}
+		return path, nil
+	}
+}
+
+// resolveLinks returns the path with every symbolic link resolved, including
+// links to files that do not exist yet.  The parts of the path that do not
+// exist are kept as they are
+func resolveLinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+
+	parent, err = resolveLinks(parent)
+	if err != nil {
+		return "", err
+	}
+
+	path = filepath.Join(parent, filepath.Base(path))
+	if target, err := os.Readlink(path); err == nil {
+		/* a link to a file that will be created */
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(parent, target)
+		}
+		return resolveLinks(target)
+	}
+	return path, nil
+}
+
+// openRedirect opens the named file for output once the shell's redirect
+// policy permits it
+func (shell *Shell) openRedirect(name string, appendOutput bool) (io.WriteCloser, error) {
+	path, err := shell.redirectPolicy(name, appendOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendOutput {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	return os.OpenFile(path, flags, 0644)
+}
+
+func redirectFilter(appendOutput bool) Command {
+	return CommandFunc(func(ctx context.Context, inv *Invocation) error {
+		if len(inv.Args) != 1 {
+			return ErrInvalidRedirect
+		}
+
+		if inv.Shell == nil {
+			return ErrRedirectDenied
+		}
+
+		file, err := inv.Shell.openRedirect(inv.Args[0], appendOutput)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(file, inv.Stdin)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+}
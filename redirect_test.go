@@ -0,0 +1,180 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("RedirectWithin", func() {
+	var policy RedirectPolicy
+	var dir string
+
+	BeforeEach(func() {
+		dir, _ = filepath.Abs("/tmp/gosh")
+		policy = RedirectWithin(dir)
+	})
+
+	It("Should resolve relative names within the directory", func() {
+		Expect(policy("out.txt", false)).To(Equal(filepath.Join(dir, "out.txt")))
+		Expect(policy("sub/../out.txt", false)).To(Equal(filepath.Join(dir, "out.txt")))
+	})
+
+	It("Should allow absolute names within the directory", func() {
+		Expect(policy(filepath.Join(dir, "out.txt"), true)).To(Equal(filepath.Join(dir, "out.txt")))
+	})
+
+	It("Should deny names outside of the directory", func() {
+		for _, name := range []string{"../out.txt", "/etc/passwd", ".", dir + "-other/out.txt"} {
+			_, err := policy(name, false)
+			Expect(err).To(MatchError(ErrRedirectDenied))
+		}
+	})
+
+	It("Should deny symbolic links that lead outside of the directory", func() {
+		root, err := os.MkdirTemp("", "gosh")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(root)
+		inside, outside := filepath.Join(root, "inside"), filepath.Join(root, "outside")
+		Expect(os.Mkdir(inside, 0755)).To(Succeed())
+		Expect(os.Mkdir(outside, 0755)).To(Succeed())
+		Expect(os.Symlink(outside, filepath.Join(inside, "dir"))).To(Succeed())
+		Expect(os.Symlink(filepath.Join(outside, "out.txt"), filepath.Join(inside, "file"))).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(inside, "sub"), 0755)).To(Succeed())
+
+		policy = RedirectWithin(inside)
+		for _, name := range []string{"dir/out.txt", "file"} {
+			_, err := policy(name, false)
+			Expect(err).To(MatchError(ErrRedirectDenied), name)
+		}
+
+		path, err := policy("sub/out.txt", false)
+		Expect(err).To(BeNil())
+		Expect(filepath.Base(path)).To(Equal("out.txt"))
+	})
+})
+
+var _ = Describe("Output redirection", func() {
+	var shell *Shell
+	var prompt *testPrompt
+	var stdout, stderr bytes.Buffer
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "gosh")
+		Expect(err).To(BeNil())
+
+		shell = NewShell(CommandMap{
+			"show": outputCommand(testConfig),
+		})
+		prompt = newTestPrompt()
+		shell.SetPrompt(prompt)
+		stdout.Reset()
+		stderr.Reset()
+		shell.SetOutputWriter(&stdout)
+		shell.SetErrorWriter(&stderr)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	readOutput := func() string {
+		b, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+		Expect(err).To(BeNil())
+		return string(b)
+	}
+
+	It("Should deny redirection by default", func() {
+		prompt.lineEditor.addResponse("show > "+filepath.Join(dir, "out.txt"), nil)
+		prompt.lineEditor.addResponse("show | redirect "+filepath.Join(dir, "out.txt"), nil)
+		prompt.lineEditor.end()
+		shell.Exec()
+		Expect(stderr.String()).To(Equal(ErrRedirectDenied.Error() + "\n" + ErrRedirectDenied.Error() + "\n"))
+		_, err := os.Stat(filepath.Join(dir, "out.txt"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should not allow a nil policy", func() {
+		Expect(shell.SetRedirectPolicy(nil)).To(MatchError(ErrNilCallback))
+	})
+
+	Describe("with a policy", func() {
+		BeforeEach(func() {
+			Expect(shell.SetRedirectPolicy(RedirectWithin(dir))).To(Succeed())
+		})
+
+		It("Should write the output to a file", func() {
+			prompt.lineEditor.addResponse("show | include eth > out.txt", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(stdout.String()).To(BeEmpty())
+			Expect(readOutput()).To(Equal("interface eth0\ninterface eth1\n"))
+		})
+
+		It("Should append the output to a file", func() {
+			prompt.lineEditor.addResponse("show | include eth0 > out.txt", nil)
+			prompt.lineEditor.addResponse("show | include eth1 >> out.txt", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(readOutput()).To(Equal("interface eth0\ninterface eth1\n"))
+		})
+
+		It("Should truncate the file when not appending", func() {
+			prompt.lineEditor.addResponse("show | include eth0 > out.txt", nil)
+			prompt.lineEditor.addResponse("show | include eth1 > out.txt", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(readOutput()).To(Equal("interface eth1\n"))
+		})
+
+		It("Should write the output to a file with the redirect filter", func() {
+			prompt.lineEditor.addResponse("show | include eth0 | redirect out.txt", nil)
+			prompt.lineEditor.addResponse("show | include eth1 | append out.txt", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(stdout.String()).To(BeEmpty())
+			Expect(readOutput()).To(Equal("interface eth0\ninterface eth1\n"))
+		})
+
+		It("Should still write errors to the error writer", func() {
+			prompt.lineEditor.addResponse("show | include ( > out.txt", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(stderr.String()).ToNot(BeEmpty())
+			Expect(readOutput()).To(BeEmpty())
+		})
+
+		It("Should deny files outside of the directory", func() {
+			prompt.lineEditor.addResponse("show > ../out.txt", nil)
+			prompt.lineEditor.end()
+			shell.Exec()
+			Expect(stderr.String()).To(Equal(ErrRedirectDenied.Error() + "\n"))
+		})
+	})
+
+	It("Should deny the redirect filter outside of a shell", func() {
+		err := DefaultFilters().Exec(context.Background(), &Invocation{Args: []string{"redirect", "out.txt"}})
+		Expect(err).To(MatchError(ErrRedirectDenied))
+	})
+})
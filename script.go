@@ -0,0 +1,115 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxScriptDepth limits how deeply scripts may source other scripts
+const maxScriptDepth = 16
+
+type scriptDepthKey struct{}
+
+// ScriptError annotates the error from a command in a script with the line
+// number of the command.  Name is the name of the script file, if known
+type ScriptError struct {
+	Name string
+	Line int
+	Err  error
+}
+
+func (e *ScriptError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.Name, e.Line, e.Err)
+}
+
+// Unwrap returns the error from the failed command
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// RunScript executes the commands read from reader without prompting
+//
+// Each line is executed just as if it had been typed at the prompt.  Blank
+// lines and lines beginning with # are ignored.  If SetStopOnError is enabled
+// then RunScript returns a *ScriptError for the first command that fails.
+// Otherwise, each *ScriptError is written to the error writer, the script
+// continues and ErrScriptFailed is returned once the script is complete
+func (shell *Shell) RunScript(reader io.Reader) error {
+	return shell.runScript(shell.ctx, shell.invocation(), "", reader)
+}
+
+func (shell *Shell) runScript(ctx context.Context, inv *Invocation, name string, reader io.Reader) error {
+	depth, _ := ctx.Value(scriptDepthKey{}).(int)
+	if depth >= maxScriptDepth {
+		return ErrScriptNesting
+	}
+	ctx = context.WithValue(ctx, scriptDepthKey{}, depth+1)
+
+	failed := false
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := shell.execLine(ctx, inv, line); err != nil {
+			err = &ScriptError{Name: name, Line: lineNum, Err: err}
+			if shell.stopOnError {
+				return err
+			}
+			fmt.Fprintf(inv.Stderr, "%v\n", err)
+			failed = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if failed {
+		return ErrScriptFailed
+	}
+	return nil
+}
+
+// sourceCommand runs the named script file in the invoking shell
+func sourceCommand(ctx context.Context, inv *Invocation) error {
+	if len(inv.Args) != 1 {
+		return ErrMissingFileName
+	}
+
+	if inv.Shell == nil {
+		return ErrNoShell
+	}
+
+	file, err := os.Open(inv.Args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return inv.Shell.runScript(ctx, inv, inv.Args[0], file)
+}
@@ -0,0 +1,174 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func echoCommand(ctx context.Context, inv *Invocation) error {
+	_, err := fmt.Fprintln(inv.Stdout, strings.Join(inv.Args, " "))
+	return err
+}
+
+var _ = Describe("Scripts", func() {
+	var shell *Shell
+	var stdout, stderr bytes.Buffer
+
+	BeforeEach(func() {
+		shell = NewShell(CommandMap{
+			"echo": CommandFunc(echoCommand),
+			"fail": CommandFunc(func(ctx context.Context, inv *Invocation) error {
+				return errors.New("failed")
+			}),
+		})
+		stdout.Reset()
+		stderr.Reset()
+		shell.SetOutputWriter(&stdout)
+		shell.SetErrorWriter(&stderr)
+	})
+
+	Describe("RunScript", func() {
+		It("Should execute each line as a command", func() {
+			Expect(shell.RunScript(strings.NewReader("echo one\necho \"two three\" | include two\n"))).To(Succeed())
+			Expect(stdout.String()).To(Equal("one\ntwo three\n"))
+		})
+
+		It("Should chain commands on a line", func() {
+			Expect(shell.RunScript(strings.NewReader("fail || echo one; echo two\n"))).To(Succeed())
+			Expect(stdout.String()).To(Equal("one\ntwo\n"))
+		})
+
+		It("Should skip blank lines and comments", func() {
+			Expect(shell.RunScript(strings.NewReader("# comment\n\n   \n  # indented comment\necho one\n"))).To(Succeed())
+			Expect(stdout.String()).To(Equal("one\n"))
+		})
+
+		It("Should continue after an error by default", func() {
+			err := shell.RunScript(strings.NewReader("echo one\nfail\nbogus\necho two\n"))
+			Expect(err).To(MatchError(ErrScriptFailed))
+			Expect(stdout.String()).To(Equal("one\ntwo\n"))
+			Expect(stderr.String()).To(Equal("line 2: failed\nline 3: no matching command\n"))
+		})
+
+		It("Should stop at the first error when enabled", func() {
+			shell.SetStopOnError(true)
+			err := shell.RunScript(strings.NewReader("echo one\n\nfail\necho two\n"))
+			Expect(err).To(Equal(&ScriptError{Line: 3, Err: errors.New("failed")}))
+			Expect(err).To(MatchError("line 3: failed"))
+			Expect(stdout.String()).To(Equal("one\n"))
+			Expect(stderr.String()).To(BeEmpty())
+		})
+
+		It("Should unwrap to the command error", func() {
+			shell.SetStopOnError(true)
+			err := shell.RunScript(strings.NewReader("bogus\n"))
+			Expect(errors.Is(err, ErrNoMatchingCommand)).To(BeTrue())
+		})
+
+		It("Should apply the shell timeout", func() {
+			shell.commands.Add("slow", slowCommand{})
+			shell.SetTimeout(time.Millisecond)
+			shell.SetStopOnError(true)
+			err := shell.RunScript(strings.NewReader("slow\n"))
+			Expect(errors.Is(err, ErrTimeout)).To(BeTrue())
+		})
+	})
+
+	Describe("source", func() {
+		var dir string
+
+		writeScript := func(name, content string) string {
+			path := filepath.Join(dir, name)
+			Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+			return path
+		}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "gosh")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("Should be a builtin", func() {
+			Expect(shell.Builtins()).To(HaveKey("source"))
+		})
+
+		It("Should execute the commands in the file", func() {
+			path := writeScript("setup", "echo one\necho two\n")
+			Expect(shell.RunScript(strings.NewReader("source " + path + " | include two\n"))).To(Succeed())
+			Expect(stdout.String()).To(Equal("two\n"))
+		})
+
+		It("Should annotate errors with the file name", func() {
+			shell.SetStopOnError(true)
+			path := writeScript("setup", "echo one\nfail\n")
+			err := shell.RunScript(strings.NewReader("source " + path + "\n"))
+			Expect(err).To(MatchError(fmt.Sprintf("line 1: %s:2: failed", path)))
+		})
+
+		It("Should stop scripts that source themselves", func() {
+			shell.SetStopOnError(true)
+			path := filepath.Join(dir, "loop")
+			writeScript("loop", "source "+path+"\n")
+			err := shell.RunScript(strings.NewReader("source " + path + "\n"))
+			Expect(errors.Is(err, ErrScriptNesting)).To(BeTrue())
+		})
+
+		It("Should require a file name", func() {
+			shell.SetStopOnError(true)
+			err := shell.RunScript(strings.NewReader("source\n"))
+			Expect(errors.Is(err, ErrMissingFileName)).To(BeTrue())
+		})
+
+		It("Should require a shell", func() {
+			err := newBuiltins().Exec(context.Background(), &Invocation{Args: []string{"source", "file"}})
+			Expect(err).To(MatchError(ErrNoShell))
+		})
+
+		It("Should be overridden by a command with the same name", func() {
+			command := newTestCommand()
+			shell.commands.Add("source", command)
+			Expect(shell.RunScript(strings.NewReader("source file\n"))).To(Succeed())
+			Expect(command.arguments).To(Equal([]string{"file"}))
+		})
+
+		It("Should be removable", func() {
+			delete(shell.Builtins(), "source")
+			Expect(shell.RunScript(strings.NewReader("source file\n"))).To(MatchError(ErrScriptFailed))
+			Expect(stderr.String()).To(Equal("line 1: no matching command\n"))
+		})
+
+		It("Should be completed along with the shell's commands", func() {
+			_, completions, _ := shell.completer.complete("", 0)
+			Expect(completions).To(Equal([]string{"disable", "echo", "enable", "fail", "fg", "help", "jobs", "kill", "source"}))
+		})
+	})
+})
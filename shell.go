@@ -17,10 +17,13 @@
 package gosh
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Shell is the foundation for Gosh
@@ -28,9 +31,38 @@ import (
 // A Shell provides a way to prompt users for command input and then execute
 // those commands.  It includes line editing, history and command completion.
 type Shell struct {
-	prompt      Prompt
-	commands    CommandMap
-	errorWriter io.Writer
+	prompt         Prompt
+	completer      *completer
+	commands       CommandMap
+	builtins       CommandMap
+	filters        CommandMap
+	modeBuiltins   CommandMap
+	modes          []*Mode
+	modeEntries    []modeEntry
+	modeLock       sync.Mutex
+	prompter       Prompter
+	redirectPolicy RedirectPolicy
+	abbreviations  bool
+	matcher        Matcher
+	privileges     Privileges
+	authenticator  Authenticator
+	authorizer     Authorizer
+	privilegeLock  sync.Mutex
+	stopOnError    bool
+	gracePeriod    time.Duration
+	timeout        time.Duration
+	lastErr        error
+	lastErrLock    sync.Mutex
+	jobs           *jobTable
+	ctx            context.Context
+	cancel         context.CancelFunc
+	inputReader    io.Reader
+	outputWriter   io.Writer
+	errorWriter    io.Writer
+
+	interrupts      <-chan os.Signal
+	notifyInterrupt func(chan<- os.Signal)
+	stopInterrupt   func(chan<- os.Signal)
 }
 
 // SetPrompter overrides the prompter when the DefaultPrompt is being used
@@ -43,8 +75,9 @@ func (shell *Shell) SetPrompter(prompter Prompter) error {
 		return ErrNilPrompter
 	}
 
-	if defaultPrompter, ok := shell.prompt.(*DefaultPrompt); ok {
-		defaultPrompter.SetPrompter(prompter)
+	if _, ok := shell.prompt.(*DefaultPrompt); ok {
+		shell.prompter = prompter
+		shell.updateMode()
 		return nil
 	}
 	return ErrDefaultPrompter
@@ -66,7 +99,8 @@ func (shell *Shell) SetPrompt(prompt Prompt) error {
 
 // SetErrorWriter overrides the error stream
 //
-// Shell defaults to use os.Stderr for error messages.  This can be overridden
+// Shell defaults to use os.Stderr for error messages.  The error stream is
+// also given to commands for their own error output.  This can be overridden
 // with a non-nil io.Writer.  A nil writer generates the ErrNilWriter error
 func (shell *Shell) SetErrorWriter(writer io.Writer) error {
 	if writer == nil {
@@ -76,40 +110,355 @@ func (shell *Shell) SetErrorWriter(writer io.Writer) error {
 	return nil
 }
 
+// SetInputReader overrides the input stream given to commands
+//
+// Shell defaults to use os.Stdin as the input for commands.  This can be
+// overridden with a non-nil io.Reader.  A nil reader generates the
+// ErrNilReader error
+func (shell *Shell) SetInputReader(reader io.Reader) error {
+	if reader == nil {
+		return ErrNilReader
+	}
+	shell.inputReader = reader
+	return nil
+}
+
+// SetOutputWriter overrides the output stream given to commands
+//
+// Shell defaults to use os.Stdout for command output.  This can be overridden
+// with a non-nil io.Writer.  A nil writer generates the ErrNilWriter error
+func (shell *Shell) SetOutputWriter(writer io.Writer) error {
+	if writer == nil {
+		return ErrNilWriter
+	}
+	shell.outputWriter = writer
+	return nil
+}
+
+// SetTerminal connects the Shell to a terminal other than the process's own,
+// such as the terminal of a remote session
+//
+// The Shell prompts for input on rw using a TerminalLineEditor and writes
+// the output of commands to the line editor, which translates line endings
+// for the terminal.  The terminal must already be in raw mode.  The returned
+// line editor is used to report changes to the size of the terminal.  Any
+// prompter that was set is kept
+func (shell *Shell) SetTerminal(rw io.ReadWriter) *TerminalLineEditor {
+	editor := newTerminalLineEditor(shell.completer, rw)
+	if prompt, ok := shell.prompt.(*DefaultPrompt); ok {
+		prompt.SetLineEditor(editor)
+	} else {
+		prompt := newDefaultPrompt(editor)
+		prompt.SetPrompter(shell.modePrompter(shell.Mode()))
+		shell.prompt = prompt
+	}
+
+	shell.inputReader = rw
+	shell.outputWriter = editor.terminal
+	shell.errorWriter = editor.terminal
+	return editor
+}
+
+// AddFilter adds a command that can be used after a pipe
+//
+// The filter receives the output of the previous command in the pipeline as
+// its Stdin.  Adding a filter with the same name as an existing filter
+// returns ErrDuplicateCommand
+func (shell *Shell) AddFilter(name string, filter Command) error {
+	return shell.filters.Add(name, filter)
+}
+
+// SetRedirectPolicy sets the policy that decides whether command output may
+// be redirected to a file
+//
+// Shell defaults to denying every redirection with ErrRedirectDenied.
+// AllowRedirects and RedirectWithin provide common policies.  A nil policy
+// generates the ErrNilCallback error
+func (shell *Shell) SetRedirectPolicy(policy RedirectPolicy) error {
+	if policy == nil {
+		return ErrNilCallback
+	}
+	shell.redirectPolicy = policy
+	return nil
+}
+
+// Builtins returns the CommandMap of commands that are built into the Shell
+//
+// Builtins are available in addition to the Shell's own commands, although a
+// command with the same name as a builtin takes precedence over it.  The map
+// may be modified to add, replace or remove builtins.  See NewShell for the
+// list of builtins
+func (shell *Shell) Builtins() CommandMap {
+	return shell.builtins
+}
+
+// SetStopOnError determines whether RunScript stops at the first command
+// that fails
+//
+// By default, the error from a failed command is written to the error writer
+// and the script continues with the next line
+func (shell *Shell) SetStopOnError(enabled bool) {
+	shell.stopOnError = enabled
+}
+
+// LastError returns the error from the last command line executed by the
+// Shell, or nil if it succeeded
+//
+// When commands are chained with ;, && or || the error is updated as each
+// command completes, so a command can use LastError to see whether the
+// command before it succeeded
+func (shell *Shell) LastError() error {
+	shell.lastErrLock.Lock()
+	defer shell.lastErrLock.Unlock()
+	return shell.lastErr
+}
+
+func (shell *Shell) setLastError(err error) {
+	shell.lastErrLock.Lock()
+	shell.lastErr = err
+	shell.lastErrLock.Unlock()
+}
+
+// SetTimeout sets how long commands executed by the Shell may run
+//
+// The timeout applies to commands executed from the prompt, from scripts and
+// by Run.  Commands that implement TimeoutCommand use their own timeout
+// instead.  When a command fails after its timeout expires, or is abandoned
+// at the end of the grace period, the error is a *TimeoutError.  A zero
+// timeout, the default, means commands are not limited
+func (shell *Shell) SetTimeout(timeout time.Duration) {
+	shell.timeout = timeout
+}
+
+// SetCompletionTimeout sets how long the line editor waits for a command to
+// provide its completion candidates
+//
+// Commands are given a context that is cancelled once the timeout expires and
+// any candidates provided by then are displayed.  A zero timeout waits until
+// the command has provided every candidate.  The default is
+// DefaultCompletionTimeout
+func (shell *Shell) SetCompletionTimeout(timeout time.Duration) {
+	shell.completer.timeout = timeout
+}
+
+// SetAbbreviations enables or disables command abbreviations
+//
+// When enabled, every command name on the command line, including filter
+// names, may be abbreviated to any prefix that uniquely identifies it.  For
+// instance, "sh int eth0" runs "show interface eth0" as long as no other
+// command starts with "sh" and no other show sub-command starts with "int".
+// Abbreviations are disabled by default
+func (shell *Shell) SetAbbreviations(enabled bool) {
+	shell.abbreviations = enabled
+	shell.completer.options = shell.findOptions()
+}
+
+// SetMatcher sets how typed words are matched to command names and completion
+// candidates
+//
+// The matcher is used to complete words and to find the commands named on the
+// command line, including filters.  For instance, with CaseInsensitiveMatch
+// "SHOW INTERFACE" runs "show interface", and if abbreviations are enabled so
+// does "SH INT".  The default is PrefixMatch
+func (shell *Shell) SetMatcher(matcher Matcher) error {
+	if matcher == nil {
+		return ErrNilCallback
+	}
+	shell.matcher = matcher
+	shell.completer.options = shell.findOptions()
+	return nil
+}
+
+func (shell *Shell) findOptions() []FindOption {
+	var options []FindOption
+	if shell.abbreviations {
+		options = append(options, AllowAbbreviations())
+	}
+
+	if shell.matcher != nil {
+		options = append(options, WithMatcher(shell.matcher))
+	}
+	return append(options, withAuthorization(shell.authorize))
+}
+
 // NewShell returns a fully initialized Shell for the given CommandMap
+//
+// The Shell includes the filters returned by DefaultFilters and the following
+// builtins:
+//
+//	disable [level] lower the privilege level
+//	enable [level]  raise the privilege level after authenticating
+//	fg <job>        display the output of a background job and wait for it
+//	help [command]  display help for commands
+//	jobs            list the background jobs
+//	kill <job>      stop a background job
+//	source <file>   run each line of the file as a command
+//
+// While a Mode is active, the exit and end builtins are also available.  The
+// Shell starts at DefaultPrivilege
 func NewShell(commands CommandMap) *Shell {
-	return &Shell{
-		prompt:      NewDefaultPrompt(commands),
-		commands:    commands,
-		errorWriter: os.Stderr,
+	completer := newCompleter(commands)
+	completer.builtins = newBuiltins()
+	completer.filters = DefaultFilters()
+	prompt := newDefaultPrompt(newDefaultLineEditor(completer))
+	shell := &Shell{
+		prompt:         prompt,
+		completer:      completer,
+		commands:       commands,
+		builtins:       completer.builtins,
+		filters:        completer.filters,
+		modeBuiltins:   newModeBuiltins(),
+		prompter:       prompt.prompter,
+		redirectPolicy: denyRedirects,
+		gracePeriod:    DefaultGracePeriod,
+		jobs:           &jobTable{},
+		inputReader:    os.Stdin,
+		outputWriter:   os.Stdout,
+		errorWriter:    os.Stderr,
+		privileges:     Privileges{Level: DefaultPrivilege},
+
+		notifyInterrupt: notifyInterrupt,
+		stopInterrupt:   stopInterrupt,
+	}
+	shell.ctx, shell.cancel = context.WithCancel(context.Background())
+	completer.options = shell.findOptions()
+	return shell
+}
+
+// Close cancels the context of the command that is executing and kills the
+// background jobs.  Any command that is executed afterwards is given a
+// context that is already cancelled.  Close is meant for a Shell whose user
+// has gone, such as the Shell of a remote session that has ended
+func (shell *Shell) Close() error {
+	shell.cancel()
+	shell.jobs.killAll()
+	return nil
+}
+
+// invocation returns an Invocation connected to the shell's streams
+func (shell *Shell) invocation() *Invocation {
+	return &Invocation{
+		Shell:   shell,
+		Timeout: shell.timeout,
+		Stdin:   shell.inputReader,
+		Stdout:  shell.outputWriter,
+		Stderr:  shell.errorWriter,
+	}
+}
+
+// commandMap returns the commands available to the shell in the current
+// mode.  The shell's commands take precedence over builtins with the same
+// name
+func (shell *Shell) commandMap() CommandMap {
+	if mode := shell.Mode(); mode != nil {
+		return mergeCommands(mode.Commands, mergeCommands(shell.modeBuiltins, shell.builtins))
+	}
+	return mergeCommands(shell.commands, shell.builtins)
+}
+
+// topLevel returns the commands at the top level of the current mode along
+// with the options that find them and the builtins through the completer's
+// index, so that the maps are not merged for every command that is executed
+func (shell *Shell) topLevel() (CommandMap, []FindOption) {
+	commands, index := shell.completer.topLevel()
+	return commands, append(shell.findOptions(), withIndex(index))
+}
+
+// execLine parses and executes a single line of input.  The commands are
+// executed with the streams of inv.  A line ending in & is started as a
+// background job
+func (shell *Shell) execLine(ctx context.Context, inv *Invocation, line string) error {
+	tokens, err := lex(line, shellOperators)
+	if err != nil || len(tokens) == 0 {
+		shell.setLastError(err)
+		return err
 	}
+
+	tokens, background := splitBackground(tokens)
+	c, err := parseChain(tokens)
+	if err != nil {
+		shell.setLastError(err)
+		return err
+	}
+
+	if background {
+		command := strings.TrimSpace(line[:tokens[len(tokens)-1].end])
+		job := shell.jobs.start(ctx, command, func(ctx context.Context, output io.Writer) error {
+			call := *inv
+			call.Stdin = strings.NewReader("")
+			call.Stdout = output
+			call.Stderr = output
+			return shell.execChain(ctx, &call, c, shell.execPipeline)
+		})
+		fmt.Fprintf(inv.Stdout, "[%d] %s\n", job.id, job.command)
+		return nil
+	}
+	return shell.execChain(ctx, inv, c, shell.execPipeline)
+}
+
+// splitBackground removes a trailing & from the tokens and reports whether
+// it was present
+func splitBackground(tokens []token) ([]token, bool) {
+	if last := tokens[len(tokens)-1]; last.kind == operatorToken && last.value == backgroundOperator {
+		return tokens[:len(tokens)-1], true
+	}
+	return tokens, false
+}
+
+// execPipeline executes the pipeline with the streams of inv, opening the
+// pipeline's output file if it is redirected
+func (shell *Shell) execPipeline(ctx context.Context, inv *Invocation, p *pipeline) error {
+	if p.redirect != "" {
+		file, err := shell.openRedirect(p.redirect, p.appendOutput)
+		if err != nil {
+			return err
+		}
+		call := *inv
+		call.Stdout = file
+		commands, options := shell.topLevel()
+		err = p.exec(ctx, commands, shell.filters, &call, options...)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	commands, options := shell.topLevel()
+	return p.exec(ctx, commands, shell.filters, inv, options...)
 }
 
 // Exec starts the Shell prompt/execute loop.
 //
-// Exec returns upon io.EOF in the input stream
+// Exec returns upon io.EOF in the input stream.  Interrupts (SIGINT) do not
+// terminate the process while Exec is running.  An interrupt at the prompt
+// discards the line being edited and an interrupt while a command is
+// executing cancels the command's context.  Either way, Exec returns to the
+// prompt
 func (shell *Shell) Exec() {
 	if prompt, ok := shell.prompt.(Closeable); ok {
 		defer prompt.Close()
 	}
 
+	interrupts, stop := shell.catchInterrupts()
+	defer stop()
+
 	for {
+		shell.jobs.notify(shell.outputWriter)
 		input, err := shell.prompt.NextResponse()
 
-		if err == io.EOF {
+		if err == io.EOF || shell.ctx.Err() != nil {
 			break
+		} else if err == ErrInterrupted {
+			continue
 		} else if err != nil {
 			fmt.Fprintf(shell.errorWriter, "%v\n", err)
 			continue
 		}
 
-		fields := strings.Fields(input)
-		if len(fields) > 0 {
-			err = shell.commands.Exec(fields)
-
-			if err != nil {
-				fmt.Fprintf(shell.errorWriter, "%v\n", err)
-			}
+		err = shell.execInterruptible(interrupts, func(ctx context.Context) error {
+			return shell.execLine(ctx, shell.invocation(), input)
+		})
+		if err != nil {
+			fmt.Fprintf(shell.errorWriter, "%v\n", err)
 		}
 	}
 }
@@ -18,11 +18,15 @@ package gosh
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"io"
 	"os"
+	"strings"
+	"time"
 )
 
 type errorCommand struct{}
@@ -31,7 +35,7 @@ func (e errorCommand) Completions() []string {
 	return nil
 }
 
-func (e errorCommand) Exec(arguments []string) error {
+func (e errorCommand) Exec(ctx context.Context, inv *Invocation) error {
 	return errors.New("This command failed to execute")
 }
 
@@ -84,6 +88,35 @@ var _ = Describe("Shell", func() {
 		})
 	})
 
+	Describe("command streams", func() {
+		It("Should use os.Stdin and os.Stdout by default", func() {
+			Expect(shell.inputReader).To(Equal(os.Stdin))
+			Expect(shell.outputWriter).To(Equal(os.Stdout))
+		})
+
+		It("Should allow overriding the input reader", func() {
+			pr, _ := io.Pipe()
+			Expect(shell.SetInputReader(pr)).To(Succeed())
+			Expect(shell.inputReader).To(Equal(pr))
+		})
+
+		It("Should prohibit setting the input reader to nil", func() {
+			Expect(shell.SetInputReader(nil)).To(MatchError(ErrNilReader))
+			Expect(shell.inputReader).To(Equal(os.Stdin))
+		})
+
+		It("Should allow overriding the output writer", func() {
+			_, pwr := io.Pipe()
+			Expect(shell.SetOutputWriter(pwr)).To(Succeed())
+			Expect(shell.outputWriter).To(Equal(pwr))
+		})
+
+		It("Should prohibit setting the output writer to nil", func() {
+			Expect(shell.SetOutputWriter(nil)).To(MatchError(ErrNilWriter))
+			Expect(shell.outputWriter).To(Equal(os.Stdout))
+		})
+	})
+
 	Describe("Exec", func() {
 		var prompt *testPrompt
 		var stderr *bufio.Reader
@@ -126,7 +159,8 @@ var _ = Describe("Shell", func() {
 				prompt.lineEditor.addResponse("", io.EOF)
 				shell.Exec()
 				Expect(command.executed).To(BeTrue())
-				Expect(command.arguments).To(Equal([]string{"test"}))
+				Expect(command.path).To(Equal([]string{"test"}))
+				Expect(command.arguments).To(Equal([]string{}))
 			})
 
 			It("Should execute a command with some arguments", func() {
@@ -134,7 +168,91 @@ var _ = Describe("Shell", func() {
 				prompt.lineEditor.end()
 				shell.Exec()
 				Expect(command.executed).To(BeTrue())
-				Expect(command.arguments).To(Equal([]string{"test", "arg1", "arg2"}))
+				Expect(command.path).To(Equal([]string{"test"}))
+				Expect(command.arguments).To(Equal([]string{"arg1", "arg2"}))
+				Expect(command.invocation.Shell).To(Equal(shell))
+			})
+
+			It("Should keep quoted arguments together", func() {
+				prompt.lineEditor.addResponse(`test "uplink to core" ''`, nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				Expect(command.arguments).To(Equal([]string{"uplink to core", ""}))
+			})
+
+			It("Should display an error for an unterminated quote", func() {
+				prompt.lineEditor.addResponse(`test "uplink`, nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				line, _, _ := stderr.ReadLine()
+				Expect(string(line)).To(Equal(ErrUnterminatedQuote.Error()))
+				Expect(command.executed).To(BeFalse())
+			})
+
+			It("Should pipe the command output through filters", func() {
+				var stdout bytes.Buffer
+				shell.SetOutputWriter(&stdout)
+				commands.Add("show", outputCommand(testConfig))
+				prompt.lineEditor.addResponse("show | include eth0", nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				Expect(stdout.String()).To(Equal("interface eth0\n"))
+			})
+
+			It("Should allow adding filters", func() {
+				filter := newTestCommand()
+				Expect(shell.AddFilter("filter", filter)).To(Succeed())
+				Expect(shell.AddFilter("include", filter)).To(MatchError(ErrDuplicateCommand))
+				prompt.lineEditor.addResponse("test | filter arg", nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				Expect(command.executed).To(BeTrue())
+				Expect(filter.arguments).To(Equal([]string{"arg"}))
+			})
+
+			It("Should allow abbreviations once enabled", func() {
+				commands.Add("other", newTestCommand())
+				prompt.lineEditor.addResponse("te", nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				Expect(command.executed).To(BeFalse())
+
+				shell.SetAbbreviations(true)
+				prompt.lineEditor.addResponse("te arg1", nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				Expect(command.path).To(Equal([]string{"test"}))
+				Expect(command.arguments).To(Equal([]string{"arg1"}))
+			})
+
+			It("Should give the shell streams to the command", func() {
+				var stdout bytes.Buffer
+				stdin := strings.NewReader("input")
+				shell.SetInputReader(stdin)
+				shell.SetOutputWriter(&stdout)
+				prompt.lineEditor.addResponse("test", nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				Expect(command.invocation.Stdin).To(Equal(stdin))
+				Expect(command.invocation.Stdout).To(Equal(&stdout))
+				Expect(command.invocation.Stderr).To(Equal(shell.errorWriter))
+			})
+
+			It("Should display an error if the command times out", func() {
+				commands.Add("slow", slowCommand{timeout: time.Millisecond})
+				prompt.lineEditor.addResponse("slow", nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				line, _, _ := stderr.ReadLine()
+				Expect(string(line)).To(Equal("slow: timed out after 1ms"))
+			})
+
+			It("Should give the shell timeout to the command", func() {
+				shell.SetTimeout(time.Minute)
+				prompt.lineEditor.addResponse("test", nil)
+				prompt.lineEditor.end()
+				shell.Exec()
+				Expect(command.invocation.Timeout).To(Equal(time.Minute))
 			})
 
 			It("Should display an error if the command execution fails", func() {
@@ -0,0 +1,294 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+// Package sshd serves gosh Shells over SSH
+//
+// Every session channel gets its own Shell, created by the function given to
+// NewServer, so that sessions do not share modes, privileges or history.  A
+// session that requests a shell is prompted with the line editor when it
+// also requested a terminal (PTY), otherwise its input is run as a script.
+// A session that requests a command, such as "ssh box show time", runs the
+// command with Shell.Run and exits with its exit code
+//
+// The source builtin is removed from every Shell, since it would let clients
+// read files on the server.  When the session ends, the Shell is closed so
+// that the command it is executing is cancelled and its background jobs are
+// killed
+package sshd
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/abates/gosh"
+	"golang.org/x/crypto/ssh"
+)
+
+// privilegesExtension is the permissions extension that carries the
+// privileges returned by the authentication handlers to the session
+const privilegesExtension = "gosh-privileges"
+
+// DefaultHandshakeTimeout is how long a client has to complete the SSH
+// handshake and authenticate
+const DefaultHandshakeTimeout = 30 * time.Second
+
+// PasswordHandler authenticates a user with a password and returns the
+// privileges of the user's Shells.  A non-nil error rejects the password
+type PasswordHandler func(user, password string) (gosh.Privileges, error)
+
+// PublicKeyHandler authenticates a user with a public key and returns the
+// privileges of the user's Shells.  A non-nil error rejects the key
+type PublicKeyHandler func(user string, key ssh.PublicKey) (gosh.Privileges, error)
+
+// Session describes the SSH session that a Shell is created for
+//
+// User is the name the client logged in with and Privileges are the
+// privileges returned by the authentication handler, which are also given to
+// the Shell.  Term is the terminal type of the session's PTY, or empty if
+// the session did not request one
+type Session struct {
+	User       string
+	RemoteAddr net.Addr
+	Privileges gosh.Privileges
+	Term       string
+}
+
+// Server is an SSH server that serves a gosh Shell to each session
+type Server struct {
+	config   *ssh.ServerConfig
+	newShell func(session *Session) *gosh.Shell
+
+	lock             sync.Mutex
+	closed           bool
+	handshakeTimeout time.Duration
+	listeners        map[net.Listener]struct{}
+	conns            map[net.Conn]struct{}
+}
+
+// NewServer returns a Server that creates a Shell for every session with
+// newShell.  At least one host key must be added and one of the
+// authentication handlers must be set before clients can log in
+func NewServer(newShell func(session *Session) *gosh.Shell) *Server {
+	return &Server{
+		config:           &ssh.ServerConfig{},
+		newShell:         newShell,
+		handshakeTimeout: DefaultHandshakeTimeout,
+		listeners:        make(map[net.Listener]struct{}),
+		conns:            make(map[net.Conn]struct{}),
+	}
+}
+
+// SetHandshakeTimeout sets how long a client has to complete the SSH
+// handshake and authenticate before its connection is closed.  A zero
+// timeout means clients are not limited.  The timeout defaults to
+// DefaultHandshakeTimeout and applies to connections accepted after it is set
+func (server *Server) SetHandshakeTimeout(timeout time.Duration) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.handshakeTimeout = timeout
+}
+
+// AddHostKey adds a private key that identifies the server to clients
+func (server *Server) AddHostKey(key ssh.Signer) {
+	server.config.AddHostKey(key)
+}
+
+// SetPasswordHandler enables password authentication.  A nil handler
+// generates the ErrNilCallback error
+func (server *Server) SetPasswordHandler(handler PasswordHandler) error {
+	if handler == nil {
+		return gosh.ErrNilCallback
+	}
+	server.config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+		privileges, err := handler(conn.User(), string(password))
+		if err != nil {
+			return nil, err
+		}
+		return permissions(conn, privileges)
+	}
+	return nil
+}
+
+// SetPublicKeyHandler enables public key authentication.  A nil handler
+// generates the ErrNilCallback error
+func (server *Server) SetPublicKeyHandler(handler PublicKeyHandler) error {
+	if handler == nil {
+		return gosh.ErrNilCallback
+	}
+	server.config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		privileges, err := handler(conn.User(), key)
+		if err != nil {
+			return nil, err
+		}
+		return permissions(conn, privileges)
+	}
+	return nil
+}
+
+// permissions carries the privileges of an authenticated user to the
+// sessions of the connection.  The user's name is used when the handler did
+// not name the user
+func permissions(conn ssh.ConnMetadata, privileges gosh.Privileges) (*ssh.Permissions, error) {
+	if privileges.User == "" {
+		privileges.User = conn.User()
+	}
+
+	encoded, err := json.Marshal(privileges)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.Permissions{Extensions: map[string]string{privilegesExtension: string(encoded)}}, nil
+}
+
+// ListenAndServe listens on the TCP address and serves clients until the
+// Server is closed
+func (server *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve accepts connections from the listener and serves each one in its own
+// goroutine.  Serve always returns an error, which is ErrServerClosed once
+// the Server has been closed
+func (server *Server) Serve(listener net.Listener) error {
+	if !server.trackListener(listener, true) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer server.trackListener(listener, false)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if server.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		if !server.trackConn(conn, true) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go server.serveConn(conn)
+	}
+}
+
+// Close stops every listener and closes every connection.  Sessions that are
+// executing a command have their channels closed
+func (server *Server) Close() error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.closed = true
+	for listener := range server.listeners {
+		listener.Close()
+	}
+
+	for conn := range server.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+func (server *Server) isClosed() bool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.closed
+}
+
+// trackListener adds the listener to, or removes it from, the listeners
+// that Close stops.  It returns false if a listener is added after the
+// Server was closed
+func (server *Server) trackListener(listener net.Listener, add bool) bool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if !add {
+		delete(server.listeners, listener)
+	} else if server.closed {
+		return false
+	} else {
+		server.listeners[listener] = struct{}{}
+	}
+	return true
+}
+
+// trackConn adds the connection to, or removes it from, the connections
+// that Close closes.  It returns false if a connection is added after the
+// Server was closed
+func (server *Server) trackConn(conn net.Conn, add bool) bool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if !add {
+		delete(server.conns, conn)
+	} else if server.closed {
+		return false
+	} else {
+		server.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+// serveConn performs the SSH handshake and then serves each session channel
+// that the client opens.  The connection is closed if the handshake does not
+// complete within the handshake timeout
+func (server *Server) serveConn(netConn net.Conn) {
+	defer server.trackConn(netConn, false)
+	defer netConn.Close()
+
+	server.lock.Lock()
+	timeout := server.handshakeTimeout
+	server.lock.Unlock()
+	if timeout > 0 {
+		netConn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	conn, channels, requests, err := ssh.NewServerConn(netConn, server.config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	netConn.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(requests)
+
+	var privileges gosh.Privileges
+	if conn.Permissions != nil {
+		json.Unmarshal([]byte(conn.Permissions.Extensions[privilegesExtension]), &privileges)
+	}
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		session := &Session{
+			User:       conn.User(),
+			RemoteAddr: conn.RemoteAddr(),
+			Privileges: privileges,
+		}
+		go server.serveSession(session, channel, channelRequests)
+	}
+}
@@ -0,0 +1,356 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package sshd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/abates/gosh"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner() ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	signer, err := ssh.NewSignerFromKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return signer
+}
+
+var _ = Describe("Server", func() {
+	var server *Server
+	var address string
+	var served chan error
+	var userKey ssh.Signer
+	var sessions chan *Session
+	var holding, cancelled chan string
+
+	/* enough ports to fill more than one line
+	 * of a terminal when they are listed
+	 */
+	ports := gosh.CommandMap{}
+	for i := 1; i <= 20; i++ {
+		ports[fmt.Sprintf("%02d", i)] = gosh.CommandFunc(func(ctx context.Context, inv *gosh.Invocation) error {
+			return nil
+		})
+	}
+
+	newShell := func(session *Session) *gosh.Shell {
+		sessions <- session
+		return gosh.NewShell(gosh.CommandMap{
+			"whoami": gosh.CommandFunc(func(ctx context.Context, inv *gosh.Invocation) error {
+				privileges := inv.Shell.Privileges()
+				fmt.Fprintf(inv.Stdout, "%s %d\n", privileges.User, privileges.Level)
+				return nil
+			}),
+			"fail": gosh.CommandFunc(func(ctx context.Context, inv *gosh.Invocation) error {
+				return errors.New("failed")
+			}),
+			"wait": gosh.CommandFunc(func(ctx context.Context, inv *gosh.Invocation) error {
+				<-ctx.Done()
+				fmt.Fprintln(inv.Stdout, "interrupted")
+				return nil
+			}),
+			"port": gosh.NewTreeCommand(ports),
+			"hold": gosh.CommandFunc(func(ctx context.Context, inv *gosh.Invocation) error {
+				holding <- inv.Args[0]
+				<-ctx.Done()
+				cancelled <- inv.Args[0]
+				return ctx.Err()
+			}),
+		})
+	}
+
+	dial := func(config *ssh.ClientConfig) (*ssh.Client, error) {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return ssh.Dial("tcp", address, config)
+	}
+
+	login := func() *ssh.Client {
+		client, err := dial(&ssh.ClientConfig{User: "admin", Auth: []ssh.AuthMethod{ssh.Password("s3cret")}})
+		Expect(err).NotTo(HaveOccurred())
+		return client
+	}
+
+	BeforeEach(func() {
+		sessions = make(chan *Session, 10)
+		holding = make(chan string, 10)
+		cancelled = make(chan string, 10)
+		userKey = newSigner()
+		server = NewServer(newShell)
+		server.AddHostKey(newSigner())
+		Expect(server.SetPasswordHandler(func(user, password string) (gosh.Privileges, error) {
+			if password != "s3cret" {
+				return gosh.Privileges{}, errors.New("wrong password")
+			}
+			return gosh.Privileges{Level: gosh.MaxPrivilege}, nil
+		})).To(Succeed())
+		Expect(server.SetPublicKeyHandler(func(user string, key ssh.PublicKey) (gosh.Privileges, error) {
+			if string(key.Marshal()) != string(userKey.PublicKey().Marshal()) {
+				return gosh.Privileges{}, errors.New("unknown key")
+			}
+			return gosh.Privileges{User: "operator", Level: 5}, nil
+		})).To(Succeed())
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		address = listener.Addr().String()
+		served = make(chan error, 1)
+		go func() { served <- server.Serve(listener) }()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		Eventually(served).Should(Receive(Equal(ErrServerClosed)))
+	})
+
+	It("Should reject nil authentication handlers", func() {
+		Expect(server.SetPasswordHandler(nil)).To(Equal(gosh.ErrNilCallback))
+		Expect(server.SetPublicKeyHandler(nil)).To(Equal(gosh.ErrNilCallback))
+	})
+
+	It("Should reject a wrong password", func() {
+		_, err := dial(&ssh.ClientConfig{User: "admin", Auth: []ssh.AuthMethod{ssh.Password("guess")}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should execute a command with the privileges of the password handler", func() {
+		client := login()
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		output, err := session.Output("whoami")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(Equal("admin 15\n"))
+
+		var info *Session
+		Eventually(sessions).Should(Receive(&info))
+		Expect(info.User).To(Equal("admin"))
+		Expect(info.RemoteAddr).NotTo(BeNil())
+		Expect(info.Term).To(BeEmpty())
+	})
+
+	It("Should authenticate with a public key", func() {
+		client, err := dial(&ssh.ClientConfig{User: "bob", Auth: []ssh.AuthMethod{ssh.PublicKeys(userKey)}})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		output, err := session.Output("whoami")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(Equal("operator 5\n"))
+
+		_, err = dial(&ssh.ClientConfig{User: "bob", Auth: []ssh.AuthMethod{ssh.PublicKeys(newSigner())}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should exit with the exit code of the command", func() {
+		client := login()
+		defer client.Close()
+		for command, code := range map[string]int{"fail": gosh.ExitFailure, "bogus": gosh.ExitUsage, "": gosh.ExitUsage} {
+			session, err := client.NewSession()
+			Expect(err).NotTo(HaveOccurred())
+			stderr := gbytes.NewBuffer()
+			session.Stderr = stderr
+			err = session.Run(command)
+			var exitError *ssh.ExitError
+			Expect(errors.As(err, &exitError)).To(BeTrue(), command)
+			Expect(exitError.ExitStatus()).To(Equal(code), command)
+			Expect(stderr.Contents()).NotTo(BeEmpty(), command)
+		}
+	})
+
+	It("Should not let clients source files on the server", func() {
+		client := login()
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		stderr := gbytes.NewBuffer()
+		session.Stderr = stderr
+		err = session.Run("source /etc/passwd")
+		var exitError *ssh.ExitError
+		Expect(errors.As(err, &exitError)).To(BeTrue())
+		Expect(exitError.ExitStatus()).To(Equal(gosh.ExitUsage))
+		Expect(string(stderr.Contents())).To(ContainSubstring("no matching command"))
+	})
+
+	It("Should cancel the command when the session ends", func() {
+		client := login()
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Start("hold foreground")).To(Succeed())
+		Eventually(holding).Should(Receive(Equal("foreground")))
+
+		Expect(session.Close()).To(Succeed())
+		Eventually(cancelled).Should(Receive(Equal("foreground")))
+	})
+
+	It("Should kill the background jobs when the session ends", func() {
+		client := login()
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		stdin, err := session.StdinPipe()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Shell()).To(Succeed())
+
+		fmt.Fprintln(stdin, "hold background &")
+		Eventually(holding).Should(Receive(Equal("background")))
+		stdin.Close()
+		Expect(session.Wait()).To(Succeed())
+		Eventually(cancelled).Should(Receive(Equal("background")))
+	})
+
+	It("Should run the input as a script without a terminal", func() {
+		client := login()
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		stdout := gbytes.NewBuffer()
+		session.Stdout = stdout
+		stdin, err := session.StdinPipe()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Shell()).To(Succeed())
+
+		fmt.Fprintln(stdin, "whoami")
+		fmt.Fprintln(stdin, "whoami")
+		stdin.Close()
+		Expect(session.Wait()).To(Succeed())
+		Expect(string(stdout.Contents())).To(Equal("admin 15\nadmin 15\n"))
+	})
+
+	It("Should prompt on a terminal", func() {
+		client := login()
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		stdout := gbytes.NewBuffer()
+		session.Stdout = stdout
+		stdin, err := session.StdinPipe()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.RequestPty("xterm", 24, 80, ssh.TerminalModes{})).To(Succeed())
+		Expect(session.Shell()).To(Succeed())
+
+		var info *Session
+		Eventually(sessions).Should(Receive(&info))
+		Expect(info.Term).To(Equal("xterm"))
+
+		/* the ports are listed in as many columns as
+		 * fit in the width of the terminal
+		 */
+		stdin.Write([]byte("port \t\x15"))
+		Eventually(stdout).Should(gbytes.Say("  01  02  .*  18  19\r\n  20\r\n"))
+
+		Expect(session.WindowChange(40, 120)).To(Succeed())
+		Eventually(func() *gbytes.Buffer {
+			stdin.Write([]byte("port \t\x15"))
+			return stdout
+		}).Should(gbytes.Say("  01  02  .*  19  20\r\n"))
+
+		stdin.Write([]byte("whoami\r"))
+		Eventually(stdout).Should(gbytes.Say("admin 15\r\n"))
+
+		stdin.Write([]byte("wait\r"))
+		Eventually(stdout).Should(gbytes.Say("wait"))
+		stdin.Write([]byte{keyCtrlC})
+		Eventually(stdout).Should(gbytes.Say("interrupted"))
+
+		stdin.Write([]byte{4})
+		Expect(session.Wait()).To(Succeed())
+	})
+
+	It("Should interrupt a command on a terminal once the input is full", func() {
+		client := login()
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		stdout := gbytes.NewBuffer()
+		session.Stdout = stdout
+		stdin, err := session.StdinPipe()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.RequestPty("xterm", 24, 80, ssh.TerminalModes{})).To(Succeed())
+		Expect(session.Shell()).To(Succeed())
+
+		stdin.Write([]byte("wait\r"))
+		Eventually(stdout).Should(gbytes.Say("wait"))
+		stdin.Write(bytes.Repeat([]byte("x"), 4*maxInput))
+		stdin.Write([]byte{keyCtrlC})
+		Eventually(stdout).Should(gbytes.Say("interrupted"))
+		Expect(session.Close()).To(Succeed())
+	})
+
+	It("Should interrupt a command with a signal", func() {
+		client := login()
+		defer client.Close()
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		stdout := gbytes.NewBuffer()
+		session.Stdout = stdout
+		Expect(session.Start("wait")).To(Succeed())
+
+		/* an interrupt that arrives before the command
+		 * starts is discarded, so keep signalling
+		 */
+		Eventually(func() *gbytes.Buffer {
+			session.Signal(ssh.SIGINT)
+			return stdout
+		}).Should(gbytes.Say("interrupted"))
+
+		var exitError *ssh.ExitError
+		Expect(errors.As(session.Wait(), &exitError)).To(BeTrue())
+		Expect(exitError.ExitStatus()).To(Equal(gosh.ExitCode(gosh.ErrInterrupted)))
+	})
+
+	It("Should close connections that do not complete the handshake in time", func() {
+		server.SetHandshakeTimeout(500 * time.Millisecond)
+		conn, err := net.Dial("tcp", address)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = io.ReadAll(conn)
+		Expect(err).NotTo(HaveOccurred())
+
+		client := login()
+		defer client.Close()
+		time.Sleep(time.Second)
+		session, err := client.NewSession()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Output("whoami")).To(Equal([]byte("admin 15\n")))
+	})
+
+	It("Should close the connections of a closed Server", func() {
+		client := login()
+		server.Close()
+		Eventually(func() error {
+			_, err := client.NewSession()
+			return err
+		}).Should(HaveOccurred())
+	})
+})
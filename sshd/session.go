@@ -0,0 +1,290 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package sshd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/abates/gosh"
+	"golang.org/x/crypto/ssh"
+)
+
+// keyCtrlC is the byte a terminal sends when Ctrl-C is pressed
+const keyCtrlC = 3
+
+// maxInput is the number of bytes of terminal input that are kept until the
+// line editor reads them, which is as long as the longest line the line
+// editor accepts.  Input beyond it is discarded
+const maxInput = 4 * 1024
+
+// ptyRequest is the payload of a pty-req request (RFC 4254 section 6.2)
+type ptyRequest struct {
+	Term   string
+	Width  uint32
+	Height uint32
+	PixelW uint32
+	PixelH uint32
+	Modes  string
+}
+
+// windowChange is the payload of a window-change request (RFC 4254
+// section 6.7)
+type windowChange struct {
+	Width  uint32
+	Height uint32
+	PixelW uint32
+	PixelH uint32
+}
+
+// signalRequest is the payload of a signal request (RFC 4254 section 6.9)
+type signalRequest struct {
+	Signal string
+}
+
+// execRequest is the payload of an exec request (RFC 4254 section 6.5)
+type execRequest struct {
+	Command string
+}
+
+// exitStatus is the payload of the exit-status request sent to the client
+type exitStatus struct {
+	Status uint32
+}
+
+// session is the state of a session channel
+type session struct {
+	*Session
+	server     *Server
+	channel    ssh.Channel
+	interrupts chan os.Signal
+
+	pty    bool
+	width  int
+	height int
+	editor *gosh.TerminalLineEditor
+	shell  *gosh.Shell
+}
+
+// serveSession handles the requests of a session channel.  The first shell
+// or exec request starts the Shell and any later one is refused
+func (server *Server) serveSession(info *Session, channel ssh.Channel, requests <-chan *ssh.Request) {
+	s := &session{
+		Session:    info,
+		server:     server,
+		channel:    channel,
+		interrupts: make(chan os.Signal, 1),
+		width:      80,
+		height:     24,
+	}
+
+	for request := range requests {
+		ok := false
+		switch request.Type {
+		case "pty-req":
+			var payload ptyRequest
+			if ssh.Unmarshal(request.Payload, &payload) == nil && s.shell == nil {
+				s.pty = true
+				s.Term = payload.Term
+				s.resize(payload.Width, payload.Height)
+				ok = true
+			}
+		case "window-change":
+			var payload windowChange
+			if ssh.Unmarshal(request.Payload, &payload) == nil {
+				s.resize(payload.Width, payload.Height)
+				ok = true
+			}
+		case "signal":
+			var payload signalRequest
+			if ssh.Unmarshal(request.Payload, &payload) == nil && payload.Signal == string(ssh.SIGINT) {
+				s.interrupt()
+				ok = true
+			}
+		case "shell":
+			if s.shell == nil {
+				s.start()
+				go s.exec(s.runShell)
+				ok = true
+			}
+		case "exec":
+			var payload execRequest
+			if ssh.Unmarshal(request.Payload, &payload) == nil && s.shell == nil {
+				s.start()
+				go s.exec(func() int { return s.runCommand(payload.Command) })
+				ok = true
+			}
+		}
+
+		if request.WantReply {
+			request.Reply(ok, nil)
+		}
+	}
+
+	/* the requests end once the channel is closed,
+	 * and nothing the Shell is still running has
+	 * anyone to report to
+	 */
+	if s.shell != nil {
+		s.shell.Close()
+	}
+}
+
+// start creates the session's Shell and connects it to the channel.  The
+// source builtin is removed since it reads files on the server
+func (s *session) start() {
+	s.shell = s.server.newShell(s.Session)
+	delete(s.shell.Builtins(), "source")
+	s.shell.SetPrivileges(s.Privileges)
+	s.shell.SetInterrupts(s.interrupts)
+
+	if !s.pty {
+		s.shell.SetInputReader(s.channel)
+		s.shell.SetOutputWriter(s.channel)
+		s.shell.SetErrorWriter(s.channel.Stderr())
+		return
+	}
+
+	/* the channel is read continuously so that
+	 * Ctrl-C interrupts a command even though the
+	 * line editor only reads while prompting.  What
+	 * is typed ahead is kept up to maxInput bytes
+	 */
+	input := newInputBuffer()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := s.channel.Read(buf)
+			if bytes.IndexByte(buf[:n], keyCtrlC) >= 0 {
+				s.interrupt()
+			}
+			input.Write(buf[:n])
+			if err != nil {
+				input.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	s.editor = s.shell.SetTerminal(struct {
+		io.Reader
+		io.Writer
+	}{input, s.channel})
+	s.editor.SetSize(s.width, s.height)
+}
+
+// resize records the size of the terminal and passes it to the line editor
+// once the Shell has started
+func (s *session) resize(width, height uint32) {
+	s.width, s.height = int(width), int(height)
+	if s.editor != nil {
+		s.editor.SetSize(s.width, s.height)
+	}
+}
+
+// interrupt interrupts the executing command, if there is one
+func (s *session) interrupt() {
+	select {
+	case s.interrupts <- os.Interrupt:
+	default:
+	}
+}
+
+// exec runs the Shell and then closes it, sends its exit status and closes
+// the channel
+func (s *session) exec(run func() int) {
+	status := run()
+	s.shell.Close()
+	s.channel.SendRequest("exit-status", false, ssh.Marshal(exitStatus{uint32(status)}))
+	s.channel.Close()
+}
+
+// runShell prompts for commands until the client ends the session.  Without
+// a terminal, the input is run as a script
+func (s *session) runShell() int {
+	if s.pty {
+		s.shell.Exec()
+		return gosh.ExitSuccess
+	}
+	return gosh.ExitCode(s.shell.RunScript(s.channel))
+}
+
+// runCommand executes a command line sent with an exec request
+func (s *session) runCommand(command string) int {
+	args, err := gosh.Split(command)
+	if err == nil && len(args) == 0 {
+		err = gosh.ErrNoMatchingCommand
+	}
+
+	if err != nil {
+		fmt.Fprintf(s.channel.Stderr(), "%v\n", err)
+		return gosh.ExitCode(err)
+	}
+	return s.shell.Run(args)
+}
+
+// inputBuffer is a pipe that writing to never waits for the reader.  It
+// keeps at most maxInput bytes and discards whatever is written while it is
+// full
+type inputBuffer struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	buffer bytes.Buffer
+	err    error
+}
+
+func newInputBuffer() *inputBuffer {
+	b := &inputBuffer{}
+	b.cond = sync.NewCond(&b.lock)
+	return b
+}
+
+func (b *inputBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	n := len(p)
+	if room := maxInput - b.buffer.Len(); n > room {
+		p = p[:room]
+	}
+	b.buffer.Write(p)
+	b.cond.Broadcast()
+	return n, nil
+}
+
+// CloseWithError causes Read to return err once the buffer is empty
+func (b *inputBuffer) CloseWithError(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.err = err
+	b.cond.Broadcast()
+}
+
+func (b *inputBuffer) Read(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for b.buffer.Len() == 0 && b.err == nil {
+		b.cond.Wait()
+	}
+
+	if b.buffer.Len() == 0 {
+		return 0, b.err
+	}
+	return b.buffer.Read(p)
+}
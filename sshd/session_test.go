@@ -0,0 +1,44 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package sshd
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("inputBuffer", func() {
+	It("Should discard what is written while it is full", func() {
+		input := newInputBuffer()
+		Expect(input.Write(bytes.Repeat([]byte("x"), maxInput-1))).To(Equal(maxInput - 1))
+		Expect(input.Write([]byte("yz"))).To(Equal(2))
+
+		buf := make([]byte, maxInput)
+		n, err := io.ReadFull(input, buf[:maxInput-1])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(maxInput - 1))
+
+		input.Write([]byte("end"))
+		input.CloseWithError(io.EOF)
+		rest, err := io.ReadAll(input)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(rest)).To(Equal("yend"))
+	})
+})
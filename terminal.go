@@ -0,0 +1,232 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+const (
+	// maxHistory is the number of lines kept in the history of the
+	// TerminalLineEditor
+	maxHistory = 500
+
+	// defaultWidth is the terminal width used until the size of the
+	// terminal is known
+	defaultWidth = 80
+)
+
+const (
+	keyCtrlC = 3
+	keyTab   = '\t'
+	keyHelp  = '?'
+
+	/* Ctrl-C is replaced in the input stream by keyInterrupt
+	 * followed by a carriage return, since the terminal
+	 * does not clear its line when Ctrl-C is pressed
+	 */
+	keyInterrupt = '\uE003'
+)
+
+// TerminalLineEditor is a LineEditor for a terminal, such as the terminal of
+// a remote session.  It uses golang.org/x/term as the line editor.  The
+// DefaultLineEditor uses a TerminalLineEditor for the process's own terminal
+//
+// Pressing Tab completes the word under the cursor or, when the word cannot
+// be completed any further, lists the candidates under a heading for each
+// group along with their descriptions.  Pressing ? anywhere on the line lists
+// what may be entered at the cursor along with a description of each item and
+// then redisplays the line with the cursor where it was.  A ? inside of
+// quotes or following a backslash is entered as an ordinary character
+type TerminalLineEditor struct {
+	completer *completer
+	history   *history
+	terminal  *term.Terminal
+
+	prompt      string
+	width       int
+	widthLock   sync.Mutex
+	interrupted bool
+}
+
+// Prompt will prompt the user with the prompt string, collect the response and
+// return it.  Non-empty responses are added to the history.  The collected
+// string and any associated error is returned.  If the user presses Ctrl-C
+// then the line is discarded and ErrInterrupted is returned
+func (d *TerminalLineEditor) Prompt(prompt string) (string, error) {
+	d.prompt = prompt
+	d.terminal.SetPrompt(prompt)
+	line, err := d.terminal.ReadLine()
+	if d.interrupted {
+		d.interrupted = false
+		return "", ErrInterrupted
+	} else if err == term.ErrPasteIndicator {
+		err = nil
+	}
+	return line, err
+}
+
+// PromptPassword prompts for a password without echoing it.  If the user
+// presses Ctrl-C then ErrInterrupted is returned
+func (d *TerminalLineEditor) PromptPassword(prompt string) (string, error) {
+	/* the terminal does not call handleKey while
+	 * reading a password, so Ctrl-C is found in
+	 * the password itself
+	 */
+	password, err := d.terminal.ReadPassword(prompt)
+	if strings.ContainsRune(password, keyInterrupt) {
+		return "", ErrInterrupted
+	}
+	return password, err
+}
+
+// SetSize sets the size of the terminal, for instance when the window of a
+// remote terminal is resized.  SetSize may be called while the user is being
+// prompted
+func (d *TerminalLineEditor) SetSize(width, height int) error {
+	d.widthLock.Lock()
+	d.width = width
+	d.widthLock.Unlock()
+	return d.terminal.SetSize(width, height)
+}
+
+// handleKey is called by the terminal for every key that it does not handle
+// itself
+func (d *TerminalLineEditor) handleKey(line string, pos int, key rune) (string, int, bool) {
+	switch key {
+	case keyInterrupt:
+		d.interrupted = true
+		return line + "^C", len(line) + 2, true
+	case keyTab:
+		return d.completeWord(line, pos)
+	case keyHelp:
+		if isLiteral(line[:pos]) {
+			return "", 0, false
+		}
+		d.display(line[:pos]+"?", d.completer.contextHelp(line, pos))
+		return line, pos, true
+	}
+	return "", 0, false
+}
+
+// completeWord replaces the word under the cursor with the candidate that
+// completes it, or with the longest prefix common to every candidate.  If the
+// word cannot be extended then the candidates are listed
+func (d *TerminalLineEditor) completeWord(line string, pos int) (string, int, bool) {
+	d.widthLock.Lock()
+	width := d.width
+	d.widthLock.Unlock()
+
+	head, word, tail, listing := d.completer.completeWord(line, pos, width)
+	if listing != "" {
+		d.display(line, listing)
+		return line, pos, true
+	}
+	return head + word + tail, len(head) + len(word), true
+}
+
+// display writes the line that is being edited followed by text.  The
+// terminal then redraws the prompt and line below the text
+func (d *TerminalLineEditor) display(line, text string) {
+	fmt.Fprintf(d.terminal, "%s%s\n%s", d.prompt, line, text)
+}
+
+// history is the list of lines entered in the line editor.  Empty lines,
+// interrupted lines and lines that repeat the previous line are not recorded
+type history struct {
+	editor  *TerminalLineEditor
+	entries []string
+}
+
+// Add appends a line to the history
+func (h *history) Add(line string) {
+	if line == "" || h.editor.interrupted {
+		return
+	}
+
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+}
+
+// Len returns the number of lines in the history
+func (h *history) Len() int {
+	return len(h.entries)
+}
+
+// At returns a line from the history.  Index 0 is the most recent line
+func (h *history) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+// interruptReader replaces Ctrl-C in the input with keyInterrupt and a
+// carriage return
+type interruptReader struct {
+	reader  io.Reader
+	pending []byte
+	err     error
+}
+
+func (r *interruptReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		buf := make([]byte, len(p))
+		var n int
+		n, r.err = r.reader.Read(buf)
+		for _, b := range buf[:n] {
+			if b == keyCtrlC {
+				r.pending = append(r.pending, string(keyInterrupt)+"\r"...)
+			} else {
+				r.pending = append(r.pending, b)
+			}
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// newTerminalLineEditor returns a line editor for a terminal that the caller
+// has already put into raw mode
+func newTerminalLineEditor(completer *completer, rw io.ReadWriter) *TerminalLineEditor {
+	d := &TerminalLineEditor{
+		completer: completer,
+		width:     defaultWidth,
+	}
+	d.history = &history{editor: d}
+	d.terminal = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{&interruptReader{reader: rw}, rw}, "")
+	d.terminal.History = d.history
+	d.terminal.AutoCompleteCallback = d.handleKey
+	return d
+}
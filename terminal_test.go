@@ -0,0 +1,129 @@
+/**
+ * Copyright 2015 Andrew Bates
+ *
+ * Licensed under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with the
+ * License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+package gosh
+
+import (
+	"bytes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io"
+	"strings"
+)
+
+var _ = Describe("formatCandidates", func() {
+	It("Should arrange candidates without groups or descriptions in columns", func() {
+		candidates := stringCandidates([]string{"one", "two", "three"})
+		Expect(formatCandidates(candidates, 80)).To(Equal(formatColumns([]string{"one", "two", "three"}, 80)))
+	})
+
+	It("Should list each group under a heading", func() {
+		candidates := []Candidate{
+			{Value: "eth0", Description: "up, 10.0.0.1/24", Group: "interfaces"},
+			{Value: "eth10", Description: "down", Group: "interfaces"},
+			{Value: "--all", Group: "flags"},
+			{Value: "--brief", Group: "flags"},
+			{Value: "all"},
+		}
+		Expect(formatCandidates(candidates, 80)).To(Equal(`all
+flags:
+  --all    --brief
+interfaces:
+  eth0     up, 10.0.0.1/24
+  eth10    down
+`))
+	})
+})
+
+var _ = Describe("TerminalLineEditor", func() {
+	var editor *TerminalLineEditor
+	var input *bytes.Buffer
+	var output bytes.Buffer
+
+	BeforeEach(func() {
+		completer := newCompleter(CommandMap{
+			"show": NewTreeCommand(CommandMap{
+				"interface":  &describedCommand{description: Description{Summary: "Display an interface", Usage: "<name>"}},
+				"interfaces": &describedCommand{description: Description{Summary: "List the interfaces"}},
+			}).WithDescription(Description{Summary: "Display system information"}),
+			"echo": CommandFunc(echoCommand),
+		})
+		input = &bytes.Buffer{}
+		output.Reset()
+		editor = newTerminalLineEditor(completer, struct {
+			io.Reader
+			io.Writer
+		}{input, &output})
+	})
+
+	It("Should complete a unique word", func() {
+		input.WriteString("sh\tinterfaces\r")
+		Expect(editor.Prompt("> ")).To(Equal("show interfaces"))
+	})
+
+	It("Should complete the common prefix and then list the candidates", func() {
+		input.WriteString("show in\t\t\r")
+		Expect(editor.Prompt("> ")).To(Equal("show interface"))
+		Expect(output.String()).To(ContainSubstring("commands:\r\n  interface   Display an interface\r\n  interfaces  List the interfaces\r\n"))
+	})
+
+	It("Should list what is valid at the cursor when ? is pressed", func() {
+		input.WriteString("show ?\r")
+		Expect(editor.Prompt("> ")).To(Equal("show "))
+		Expect(output.String()).To(ContainSubstring("> show ?\r\n  interface   Display an interface\r\n  interfaces  List the interfaces\r\n"))
+	})
+
+	It("Should list what is valid in the middle of the line and redisplay it", func() {
+		input.WriteString("sh interfaces" + strings.Repeat("\x1b[D", 11) + "?o\r")
+		Expect(editor.Prompt("> ")).To(Equal("sho interfaces"))
+		Expect(output.String()).To(ContainSubstring("> sh?\r\n  show  Display system information\r\n> sh interfaces\x1b[11D"))
+	})
+
+	It("Should enter ? in quotes as an ordinary character", func() {
+		input.WriteString(`echo "a?" \?` + "\r")
+		Expect(editor.Prompt("> ")).To(Equal(`echo "a?" \?`))
+	})
+
+	It("Should discard the line when Ctrl-C is pressed", func() {
+		input.WriteString("show\x03echo\r")
+		_, err := editor.Prompt("> ")
+		Expect(err).To(MatchError(ErrInterrupted))
+		Expect(editor.Prompt("> ")).To(Equal("echo"))
+		Expect(editor.history.Len()).To(Equal(1))
+		Expect(editor.history.At(0)).To(Equal("echo"))
+	})
+
+	It("Should return io.EOF at the end of the input", func() {
+		_, err := editor.Prompt("> ")
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("Should read a password without echoing or recording it", func() {
+		input.WriteString("s3cret?\r")
+		Expect(editor.PromptPassword("Password: ")).To(Equal("s3cret?"))
+		Expect(output.String()).To(Equal("Password: \r\n"))
+		Expect(editor.history.Len()).To(Equal(0))
+
+		input.WriteString("sh\t\r")
+		Expect(editor.Prompt("> ")).To(Equal("show "))
+	})
+
+	It("Should discard the password when Ctrl-C is pressed", func() {
+		input.WriteString("s3c\x03")
+		_, err := editor.PromptPassword("Password: ")
+		Expect(err).To(MatchError(ErrInterrupted))
+	})
+})